@@ -0,0 +1,301 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package cmd
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"ssltool/pkg/ca"
+	"ssltool/pkg/gen"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var caCmd = &cobra.Command{
+	Use:   "ca",
+	Short: "Run a small private CA.",
+	Long: `Create a root (and optional intermediate) CA in a directory and issue certificates from it.
+Issued serials are tracked in index.json and copies of the certificates are kept in certs/.`,
+}
+
+var caInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create a root CA and optional intermediate.",
+	Long: `Create a root CA, and an intermediate that signs certificates if --intermediate is given.
+The subject is read from COUNTRY, ORG, OU, LOCALITY and PROVINCE like gen, or entered interactively.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		scanner := bufio.NewScanner(os.Stdin)
+		country := promptForInfo(scanner, "COUNTRY", "COUNTRY: ")
+		org := promptForInfo(scanner, "ORG", "ORG: ")
+		ou := promptForInfo(scanner, "OU", "OU: ")
+		locality := promptForInfo(scanner, "LOCALITY", "LOCALITY: ")
+		province := promptForInfo(scanner, "PROVINCE", "PROVINCE: ")
+
+		opts := ca.InitOptions{
+			Subject:          getSubject(country, org, ou, locality, province, caInitCN),
+			IntermediateName: caInitIntermediate,
+			KeyType:          caInitKeyType,
+			Bits:             caInitBits,
+			Days:             caInitDays,
+			KDF:              caInitKDF,
+			Config:           ca.Config{CRLURLs: caInitCRLURLs, OCSPURLs: caInitOCSPURLs},
+		}
+		if caInitEncrypt {
+			passphrase, err := passphraseFromFlags(caPass, caPassFile)
+			if err == nil && passphrase == "" {
+				passphrase, err = promptNewPassphrase("CA key passphrase: ")
+			}
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			opts.Passphrase = []byte(passphrase)
+		}
+
+		authority, err := ca.Init(caDir, opts)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		fmt.Printf("Created root CA %s in %s\n", authority.Root.Subject, caDir)
+		if authority.Intermediate != nil {
+			fmt.Printf("Created intermediate CA %s\n", authority.Intermediate.Subject)
+		}
+	},
+}
+
+var caSignCmd = &cobra.Command{
+	Use:   "sign <csr>",
+	Short: "Sign a certificate request.",
+	Long: `Sign a PEM or DER certificate request, e.g. from gen, with the server, client, code-signing or ocsp-signing profile.
+Only the subject and SANs of the request are copied into the certificate.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		csr, err := ca.ParseRequest(data)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		authority := loadCA()
+		cert, err := authority.Sign(csr, caProfile, caDays)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		writeOutput(caCertOut, issuedPEM(authority, cert), "Couldn't write out cert file.")
+		printIssued(cert)
+	},
+}
+
+var caIssueCmd = &cobra.Command{
+	Use:   "issue",
+	Short: "Generate a key and certificate in one step.",
+	Long: `Generate a key and certificate request like gen and sign it with the CA.
+The subject is read from COUNTRY, ORG, OU, LOCALITY and PROVINCE when they are set.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		authority := loadCA()
+		key, err := gen.GenerateKey(caIssueKeyType, caIssueBits)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		subj := getSubject(os.Getenv("COUNTRY"), os.Getenv("ORG"), os.Getenv("OU"), os.Getenv("LOCALITY"), os.Getenv("PROVINCE"), caIssueCN)
+		cert, csrOutput, err := authority.Issue(gen.CsrInputInfo{
+			CommonName: caIssueCN,
+			Sans:       trimStrings(caIssueSans),
+			Name:       subj,
+			PrivKey:    key,
+			KeyFormat:  caIssueKeyFormat,
+		}, caProfile, caDays)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		writeOutput(caCertOut, issuedPEM(authority, cert), "Couldn't write out cert file.")
+		writeKey(caKeyOut, csrOutput.PrivateKeyPem, csrOutput.PrivateKeyDer)
+		printIssued(cert)
+	},
+}
+
+var caRevokeCmd = &cobra.Command{
+	Use:   "revoke <serial>",
+	Short: "Revoke an issued certificate.",
+	Long: `Mark a certificate in the index as revoked. The serial is in hex as printed by sign, issue,
+details and inspect. Run ca crl afterwards to publish the revocation.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		authority := loadCA()
+		entry, err := authority.Revoke(args[0], caRevokeReason, time.Now())
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		fmt.Printf("Revoked %s (%s) with reason %s\n", entry.Serial, entry.Subject, entry.Reason)
+	},
+}
+
+var caCRLCmd = &cobra.Command{
+	Use:   "crl",
+	Short: "Create a signed CRL of the revoked certificates.",
+	Long: `Create a CRL signed by the issuing CA with the next CRL number, valid until --days from now.
+Publish it at the URL given to ca init with --crl-url.
+The CRL only covers certificates issued by the CA. The intermediate itself has no CRL
+distribution point and can't be revoked; replace the CA with a new ca init instead.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if caCRLFormat != "pem" && caCRLFormat != "der" {
+			fmt.Printf("Unsupported format: %s\n", caCRLFormat)
+			os.Exit(1)
+		}
+		authority := loadCA()
+		crl, err := authority.CRL(time.Now(), caCRLDays)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		if caCRLFormat == "pem" {
+			writeOutput(caCRLOut, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl.Raw}), "Couldn't write out CRL file.")
+		} else {
+			writeDER(caCRLOut, crl.Raw, "Couldn't write out CRL file.")
+		}
+		fmt.Fprintf(os.Stderr, "CRL %s with %d revoked certificates, next update %s\n", crl.Number, len(crl.RevokedCertificateEntries), crl.NextUpdate.Format(time.RFC3339))
+	},
+}
+
+// loadCA opens the CA in --dir, prompting for the key passphrase if needed.
+func loadCA() *ca.CA {
+	passphrase, err := passphraseFromFlags(caPass, caPassFile)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	authority, err := ca.Load(caDir, []byte(passphrase))
+	if errors.Is(err, ca.ErrPassphraseRequired) {
+		passphrase, err = promptPassphrase("CA key passphrase: ")
+		if err == nil {
+			authority, err = ca.Load(caDir, []byte(passphrase))
+		}
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	return authority
+}
+
+// issuedPEM is the certificate, followed by the intermediate with --chain.
+func issuedPEM(authority *ca.CA, cert *x509.Certificate) []byte {
+	chain := []*x509.Certificate{cert}
+	if caChain {
+		chain = authority.Chain(cert)
+	}
+	var data []byte
+	for _, c := range chain {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	return data
+}
+
+// printIssued goes to stderr so the certificate can be written to stdout.
+func printIssued(cert *x509.Certificate) {
+	fmt.Fprintf(os.Stderr, "Issued %s with serial %s, valid until %s\n", cert.Subject, ca.FormatSerial(cert.SerialNumber), cert.NotAfter.Format("2006-01-02"))
+}
+
+var caDir = "ca"
+var caPass = ""
+var caPassFile = ""
+
+var caInitCN = ""
+var caInitIntermediate = ""
+var caInitKeyType = gen.KeyTypeECDSA
+var caInitBits = 4096
+var caInitDays = ca.DefaultCADays
+var caInitEncrypt = false
+var caInitKDF = gen.KDFPBKDF2
+
+var caProfile = ca.ProfileServer
+var caDays = gen.DefaultDays
+var caCertOut = "-"
+var caChain = false
+
+var caIssueCN = ""
+var caIssueSans = make([]string, 0)
+var caIssueKeyType = gen.KeyTypeECDSA
+var caIssueBits = 2048
+var caIssueKeyFormat = ""
+var caKeyOut = "-"
+
+var caInitCRLURLs = make([]string, 0)
+var caInitOCSPURLs = make([]string, 0)
+var caRevokeReason = ""
+var caCRLDays = ca.DefaultCRLDays
+var caCRLOut = "-"
+var caCRLFormat = "pem"
+
+var caExamples = `
+ssltool ca init --cn "Example Root CA" --intermediate "Example Issuing CA"
+ssltool ca sign www.csr --profile server --days 90 --out www.crt --chain
+ssltool ca issue -c client01 --profile client --certout client01.crt --keyout client01.key
+ssltool ca revoke 1a4c6f4d955d0c94e17b4445c2972fe5 --reason keyCompromise
+ssltool ca crl --days 7 --format der --out ca.crl`
+
+func init() {
+	rootCmd.AddCommand(caCmd)
+	caCmd.AddCommand(caInitCmd)
+	caCmd.AddCommand(caSignCmd)
+	caCmd.AddCommand(caIssueCmd)
+	caCmd.AddCommand(caRevokeCmd)
+	caCmd.AddCommand(caCRLCmd)
+	caCmd.Example = caExamples
+	caCmd.PersistentFlags().StringVar(&caDir, "dir", "ca", "CA directory")
+	caCmd.PersistentFlags().StringVar(&caPass, "pass", "", "Passphrase for the CA keys (default $SSLTOOL_PASS)")
+	caCmd.PersistentFlags().StringVar(&caPassFile, "pass-file", "", "Read the CA passphrase from the first line of a file")
+
+	caInitCmd.Flags().StringVarP(&caInitCN, "cn", "c", "", "Root CA common name")
+	caInitCmd.Flags().StringVar(&caInitIntermediate, "intermediate", "", "Also create an intermediate CA with this common name")
+	caInitCmd.Flags().StringVarP(&caInitKeyType, "key-type", "k", gen.KeyTypeECDSA, "Key type (rsa, ecdsa, ed25519)")
+	caInitCmd.Flags().IntVarP(&caInitBits, "bits", "b", 4096, "RSA bits (only for RSA key type)")
+	caInitCmd.Flags().IntVar(&caInitDays, "days", ca.DefaultCADays, "Days the CA certificates are valid for")
+	caInitCmd.Flags().BoolVar(&caInitEncrypt, "encrypt", false, "Encrypt the CA keys as PKCS#8 with AES-256-CBC")
+	caInitCmd.Flags().StringVar(&caInitKDF, "kdf", gen.KDFPBKDF2, "Key derivation for --encrypt (pbkdf2, scrypt)")
+	caInitCmd.Flags().StringSliceVar(&caInitCRLURLs, "crl-url", []string{}, "CRL distribution point added to issued certificates")
+	caInitCmd.Flags().StringSliceVar(&caInitOCSPURLs, "ocsp-url", []string{}, "OCSP responder URL added to issued certificates")
+	err := caInitCmd.MarkFlagRequired("cn")
+	if err != nil {
+		log.Fatalln("Couldn't mark cn as required.")
+	}
+
+	profiles := "Certificate profile (" + strings.Join(ca.Profiles, ", ") + ")"
+	for _, c := range []*cobra.Command{caSignCmd, caIssueCmd} {
+		c.Flags().StringVar(&caProfile, "profile", ca.ProfileServer, profiles)
+		c.Flags().IntVar(&caDays, "days", gen.DefaultDays, "Days the certificate is valid for")
+		c.Flags().BoolVar(&caChain, "chain", false, "Append the intermediate to the certificate")
+	}
+	caSignCmd.Flags().StringVar(&caCertOut, "out", "-", "Cert out filename. - for stdout")
+	caIssueCmd.Flags().StringVar(&caCertOut, "certout", "-", "Cert out filename. - for stdout")
+
+	caIssueCmd.Flags().StringVarP(&caIssueCN, "cn", "c", "", "Common name")
+	caIssueCmd.Flags().StringSliceVarP(&caIssueSans, "sans", "s", []string{}, "Sans list. In the form www.example.com,10.0.0.5,email:admin@example.com,uri:spiffe://example.org/web")
+	caIssueCmd.Flags().StringVarP(&caIssueKeyType, "key-type", "k", gen.KeyTypeECDSA, "Key type (rsa, ecdsa, ed25519)")
+	caIssueCmd.Flags().IntVarP(&caIssueBits, "bits", "b", 2048, "RSA bits (only for RSA key type)")
+	caIssueCmd.Flags().StringVar(&caIssueKeyFormat, "key-format", "", "Key encoding (pkcs1, sec1, pkcs8, der)")
+	caIssueCmd.Flags().StringVar(&caKeyOut, "keyout", "-", "Key out filename. - for stdout")
+
+	caRevokeCmd.Flags().StringVar(&caRevokeReason, "reason", "unspecified", "RFC 5280 reason, e.g. keyCompromise, superseded, cessationOfOperation")
+
+	caCRLCmd.Flags().IntVar(&caCRLDays, "days", ca.DefaultCRLDays, "Days until the next update")
+	caCRLCmd.Flags().StringVar(&caCRLOut, "out", "-", "CRL out filename. - for stdout")
+	caCRLCmd.Flags().StringVar(&caCRLFormat, "format", "pem", "CRL encoding (pem, der)")
+}
@@ -0,0 +1,100 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"ssltool/pkg/check"
+	"ssltool/pkg/details"
+	"ssltool/pkg/starttls"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// checkCmd represents the check command
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check certificate expiry against thresholds.",
+	Long: `Check every certificate returned from a host against warning and critical
+expiry thresholds. Prints a single status line with perfdata and exits with
+Nagios plugin codes: 0 OK, 1 WARNING, 2 CRITICAL, 3 UNKNOWN.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		result := runCheck()
+		fmt.Println(result)
+		os.Exit(int(result.Status))
+	},
+}
+
+func runCheck() check.Result {
+	warn, err := check.ParseDuration(checkWarn)
+	if err != nil {
+		return check.UnknownResult(err)
+	}
+	crit, err := check.ParseDuration(checkCrit)
+	if err != nil {
+		return check.UnknownResult(err)
+	}
+	if crit > warn {
+		return check.UnknownResult(errors.New("critical threshold must not be greater than warning threshold"))
+	}
+	roots, err := details.LoadRoots(checkCAFiles, checkCADirs, checkNoSystemRoots)
+	if err != nil {
+		return check.UnknownResult(err)
+	}
+	chain, err := details.RetrieveCertDetails(details.Options{
+		Address:        fmt.Sprintf("%s:%d", checkHost, checkPort),
+		ConnectAddress: checkConnect,
+		ServerName:     checkSNI,
+		Timeout:        checkTimeout,
+		Insecure:       checkInsecure,
+		StartTLS:       checkStartTLS,
+		Roots:          roots,
+	})
+	if err != nil {
+		return check.CriticalResult(err)
+	}
+	return check.Evaluate(chain, check.Thresholds{Warning: warn, Critical: crit}, time.Now())
+}
+
+var (
+	checkHost     = ""
+	checkPort     = 443
+	checkInsecure = false
+	checkStartTLS = ""
+	checkSNI      = ""
+	checkConnect  = ""
+	checkTimeout  = details.DefaultTimeout
+
+	checkCAFiles       = make([]string, 0)
+	checkCADirs        = make([]string, 0)
+	checkNoSystemRoots = false
+	checkWarn          = "30d"
+	checkCrit          = "7d"
+)
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+	checkCmd.Example = `ssltool check --host www.example.com --warn 30d --crit 7d`
+	checkCmd.Flags().StringVar(&checkHost, "host", "", "hostname to check certificate.")
+	checkCmd.Flags().IntVar(&checkPort, "port", 443, "port")
+	checkCmd.Flags().BoolVarP(&checkInsecure, "insecure", "i", false, "Don't verify certificates.")
+	checkCmd.Flags().StringVar(&checkStartTLS, "starttls", "", "Upgrade a plain connection first ("+strings.Join(starttls.Protocols, ", ")+")")
+	checkCmd.Flags().StringVar(&checkSNI, "sni", "", "Server name to send and verify instead of the host")
+	checkCmd.Flags().StringVar(&checkConnect, "connect", "", "Address to connect to instead of resolving the host")
+	checkCmd.Flags().DurationVarP(&checkTimeout, "timeout", "t", details.DefaultTimeout, "Connection and handshake timeout")
+	checkCmd.Flags().StringSliceVar(&checkCAFiles, "ca-file", []string{}, "PEM bundle of trusted CA certificates")
+	checkCmd.Flags().StringSliceVar(&checkCADirs, "ca-dir", []string{}, "Directory of PEM CA certificates (e.g. hashed with c_rehash)")
+	checkCmd.Flags().BoolVar(&checkNoSystemRoots, "no-system-roots", false, "Only trust CAs from --ca-file and --ca-dir")
+	checkCmd.Flags().StringVarP(&checkWarn, "warn", "w", "30d", "Warning threshold (e.g. 30d, 72h)")
+	checkCmd.Flags().StringVarP(&checkCrit, "crit", "c", "7d", "Critical threshold (e.g. 7d, 24h)")
+	err := checkCmd.MarkFlagRequired("host")
+	if err != nil {
+		log.Fatalln("Couldn't require the hostname argument.")
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"ssltool/pkg/ciphers"
+	"ssltool/pkg/details"
+	"ssltool/pkg/starttls"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// ciphersCmd represents the ciphers command
+var ciphersCmd = &cobra.Command{
+	Use:   "ciphers",
+	Short: "Enumerate supported TLS versions and cipher suites.",
+	Long: `Handshake repeatedly with a single protocol version and cipher suite offered to
+find out which ones a host accepts. Weak versions and suites (TLS 1.0/1.1, CBC,
+3DES, RC4, RSA key exchange) are flagged and the configuration is graded A to F.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := validOutputFormat(ciphersOutputFormat); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		result, err := ciphers.Enumerate(context.Background(), details.Options{
+			Address:        fmt.Sprintf("%s:%d", ciphersHost, ciphersPort),
+			ConnectAddress: ciphersConnect,
+			ServerName:     ciphersSNI,
+			Timeout:        ciphersTimeout,
+			StartTLS:       ciphersStartTLS,
+		})
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		if ciphersOutputFormat != outputText {
+			if err := writeStructured(os.Stdout, ciphersOutputFormat, result); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			return
+		}
+		for _, version := range result.Versions {
+			if !version.Supported {
+				fmt.Printf("%s: not supported\n", version.Version)
+				continue
+			}
+			fmt.Printf("%s: supported%s\n", version.Version, weaknessNote(version.Weaknesses))
+			for _, suite := range version.Suites {
+				fmt.Printf("  - %s%s\n", suite.Name, weaknessNote(suite.Weaknesses))
+			}
+		}
+		fmt.Printf("Grade: %s\n", result.Grade)
+		for _, finding := range result.Findings {
+			fmt.Printf("  - %s\n", finding)
+		}
+	},
+}
+
+func weaknessNote(weaknesses []string) string {
+	if len(weaknesses) == 0 {
+		return ""
+	}
+	return " (weak: " + strings.Join(weaknesses, ", ") + ")"
+}
+
+var (
+	ciphersHost         = ""
+	ciphersPort         = 443
+	ciphersSNI          = ""
+	ciphersConnect      = ""
+	ciphersTimeout      = details.DefaultTimeout
+	ciphersStartTLS     = ""
+	ciphersOutputFormat = outputText
+)
+
+func init() {
+	rootCmd.AddCommand(ciphersCmd)
+	ciphersCmd.Example = `ssltool ciphers --host www.example.com
+ssltool ciphers --host mail.example.com --port 25 --starttls smtp --output json`
+	ciphersCmd.Flags().StringVar(&ciphersHost, "host", "", "hostname to check.")
+	ciphersCmd.Flags().IntVar(&ciphersPort, "port", 443, "port")
+	ciphersCmd.Flags().StringVar(&ciphersSNI, "sni", "", "Server name to send instead of the host")
+	ciphersCmd.Flags().StringVar(&ciphersConnect, "connect", "", "Address to connect to instead of resolving the host")
+	ciphersCmd.Flags().DurationVarP(&ciphersTimeout, "timeout", "t", details.DefaultTimeout, "Timeout per handshake")
+	ciphersCmd.Flags().StringVar(&ciphersStartTLS, "starttls", "", "Upgrade a plain connection first ("+strings.Join(starttls.Protocols, ", ")+")")
+	ciphersCmd.Flags().StringVarP(&ciphersOutputFormat, "output", "o", outputText, "Output format (text, json, yaml)")
+	err := ciphersCmd.MarkFlagRequired("host")
+	if err != nil {
+		log.Fatalln("Couldn't require the hostname argument.")
+	}
+}
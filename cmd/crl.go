@@ -0,0 +1,128 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package cmd
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"ssltool/pkg/details"
+	"ssltool/pkg/revocation"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var crlCmd = &cobra.Command{
+	Use:   "crl",
+	Short: "Work with certificate revocation lists.",
+}
+
+var crlInspectCmd = &cobra.Command{
+	Use:   "inspect <file|url>",
+	Short: "Print the entries of a CRL.",
+	Long:  `Print the issuer, validity and revoked serials of a PEM or DER CRL read from a file or an http(s) URL.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := validOutputFormat(crlOutputFormat); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		var crl *x509.RevocationList
+		var err error
+		if revocation.IsURL(args[0]) {
+			client := &http.Client{Timeout: crlTimeout}
+			crl, err = revocation.FetchCRL(context.Background(), client, args[0], "", time.Now())
+		} else {
+			var data []byte
+			data, err = os.ReadFile(args[0])
+			if err == nil {
+				crl, err = revocation.ParseCRL(data)
+			}
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		if crlIssuerFile != "" {
+			issuer, err := loadCertificate(crlIssuerFile)
+			if err == nil {
+				err = crl.CheckSignatureFrom(issuer)
+			}
+			if err != nil {
+				fmt.Printf("Signature verification failed: %s\n", err.Error())
+				os.Exit(1)
+			}
+		}
+
+		info := revocation.NewCRLInfo(crl)
+		if crlOutputFormat != outputText {
+			if err := writeStructured(os.Stdout, crlOutputFormat, info); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			return
+		}
+		printCRLInfo(info, crlIssuerFile != "")
+	},
+}
+
+// printCRLInfo prints a CRL, with a line saying its signature was verified
+// when verified is set.
+func printCRLInfo(info revocation.CRLInfo, verified bool) {
+	fmt.Printf("Issuer: %s\n", info.Issuer)
+	if info.Number != "" {
+		fmt.Printf("  CRL Number: %s\n", info.Number)
+	}
+	fmt.Printf("  This Update: %s\n", info.ThisUpdate.Format(time.RFC3339))
+	if !info.NextUpdate.IsZero() {
+		fmt.Printf("  Next Update: %s\n", info.NextUpdate.Format(time.RFC3339))
+	}
+	fmt.Printf("  Signature Algorithm: %s\n", info.SignatureAlgorithm)
+	if verified {
+		fmt.Println("  Signature: verified")
+	}
+	fmt.Printf("Revoked Certificates: %d\n", len(info.Entries))
+	for _, entry := range info.Entries {
+		fmt.Printf("  - Serial: %s\n    Revoked: %s\n", entry.Serial, entry.RevokedAt.Format(time.RFC3339))
+		if entry.Reason != "" {
+			fmt.Printf("    Reason: %s\n", entry.Reason)
+		}
+	}
+}
+
+// loadCertificate reads the first certificate from a PEM or DER file.
+func loadCertificate(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != "CERTIFICATE" {
+			return nil, errors.New(path + ": no certificate found")
+		}
+		data = block.Bytes
+	}
+	return x509.ParseCertificate(data)
+}
+
+var crlIssuerFile = ""
+var crlTimeout = details.DefaultTimeout
+var crlOutputFormat = outputText
+var crlExample = `ssltool crl inspect ca.crl
+ssltool crl inspect http://crl.example.com/ca.crl --issuer ca.pem
+ssltool crl inspect ca.crl --output json | jq '.entries[].serial'`
+
+func init() {
+	rootCmd.AddCommand(crlCmd)
+	crlCmd.AddCommand(crlInspectCmd)
+	crlInspectCmd.Example = crlExample
+	crlInspectCmd.Flags().StringVar(&crlIssuerFile, "issuer", "", "Issuer certificate to verify the CRL signature with")
+	crlInspectCmd.Flags().DurationVarP(&crlTimeout, "timeout", "t", details.DefaultTimeout, "Download timeout")
+	crlInspectCmd.Flags().StringVarP(&crlOutputFormat, "output", "o", outputText, "Output format (text, json, yaml)")
+}
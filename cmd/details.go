@@ -4,10 +4,15 @@ Copyright © 2023 Dex Wood
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"ssltool/pkg/details"
+	"ssltool/pkg/revocation"
+	"ssltool/pkg/starttls"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -19,47 +24,427 @@ var detailsCmd = &cobra.Command{
 	Short: "Retrieve certificates details.",
 	Long:  `Retrieve details about certificates returned from a host.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		retrieveDetails, err := details.RetrieveCertDetails(fmt.Sprintf("%s:%d", hostname, port), insecure)
+		if err := validOutputFormat(outputFormat); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		expectedPins := make([]string, len(pins))
+		for i, pin := range pins {
+			normalized, err := details.NormalizePin(pin)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			expectedPins[i] = normalized
+		}
+		address := fmt.Sprintf("%s:%d", hostname, port)
+		roots, err := details.LoadRoots(caFiles, caDirs, noSystemRoots)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		opts := details.Options{
+			Address:             address,
+			ConnectAddress:      connectAddress,
+			ServerName:          serverName,
+			NoSNI:               noSNI,
+			Timeout:             timeout,
+			StartTLS:            startTLS,
+			Roots:               roots,
+			CheckResumption:     checkResumption,
+			FetchMissingIssuers: !noAIA,
+		}
+		if len(alpn) > 0 && startTLS == "" {
+			opts.NextProtos = alpn
+		}
+		if clientCertFile != "" {
+			password := clientPass
+			if password == "" {
+				password = os.Getenv("SSLTOOL_CLIENT_PASS")
+			}
+			clientCert, err := details.LoadClientCertificate(clientCertFile, clientKeyFile, password)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			opts.ClientCertificate = &clientCert
+		}
+		result, err := details.Retrieve(opts)
 		if err != nil {
+			printClientAuth(result.ClientAuth)
 			fmt.Println(err.Error())
 			os.Exit(1)
 		}
-		for _, certDetails := range retrieveDetails {
-			fmt.Printf("Issuer: %s\n  Expiration Date: %v\n  Issue Date: %v\n  Serial: %x\n", 
-			certDetails.Issuer, 
-			certDetails.NotAfter.Format(time.RFC3339), 
-			certDetails.Cert.NotBefore.Format(time.RFC3339), 
-			certDetails.Cert.SerialNumber)
-			if len(certDetails.DNSNames) > 0 {
-				fmt.Println("  DNS Names:")
-				for _, name := range certDetails.DNSNames {
-					fmt.Printf("  - %s\n", name)
-				}
+		var revocations []revocation.Status
+		if checkOCSP {
+			client := &http.Client{Timeout: timeout}
+			chain := result.RevocationChain()
+			revocations = revocation.CheckOCSPChain(context.Background(), client, chain, result.Connection.OCSPResponse, time.Now())
+		}
+		if checkCRL {
+			cacheDir := crlCacheDir
+			if noCRLCache {
+				cacheDir = ""
+			} else if cacheDir == "" {
+				// without a cache directory CRLs are just downloaded every time
+				cacheDir, _ = revocation.DefaultCacheDir()
+			}
+			client := &http.Client{Timeout: timeout}
+			chain := result.RevocationChain()
+			revocations = append(revocations, revocation.CheckCRLChain(context.Background(), client, chain, cacheDir, time.Now())...)
+		}
+		var pinCheck *pinResult
+		if len(expectedPins) > 0 {
+			pinCheck = &pinResult{}
+			if matched, ok := details.MatchPins(result.Chain, expectedPins); ok {
+				pinCheck.Matched = true
+				pinCheck.Subject = matched.Cert.Subject.String()
+				pinCheck.Pin = matched.SPKIPin
+			}
+		}
+		if outputFormat != outputText {
+			output := detailsOutput{
+				Report:     details.NewResultReport(address, result),
+				Revocation: revocations,
+				Pin:        pinCheck,
+			}
+			err := writeStructured(os.Stdout, outputFormat, output)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
 			}
-			if displayCertPem {
-				details.DisplayPemCertificate(certDetails)
+		} else {
+			for _, certDetails := range result.Chain {
+				printCertDetails(certDetails, displayFull, displayCertPem)
 			}
-			fmt.Println()
+			printConnection(result.Connection)
+			printVerification(result.Verification)
+			printLint(result.Lint)
+			printCompletion(result)
+			printClientAuth(result.ClientAuth)
+			printRevocation(revocations)
+			printPinResult(pinCheck)
+		}
+		if !result.Verification.Trusted && !insecure {
+			os.Exit(1)
+		}
+		for _, status := range revocations {
+			if status.Status == revocation.StatusRevoked {
+				os.Exit(1)
+			}
+		}
+		if pinCheck != nil && !pinCheck.Matched {
+			os.Exit(1)
 		}
 	},
 }
 
+// detailsOutput adds the checks done outside of pkg/details to its report.
+type detailsOutput struct {
+	details.Report `yaml:",inline"`
+	Revocation     []revocation.Status `json:"revocation,omitempty" yaml:"revocation,omitempty"`
+	Pin            *pinResult          `json:"pin,omitempty" yaml:"pin,omitempty"`
+}
+
+type pinResult struct {
+	Matched bool   `json:"matched" yaml:"matched"`
+	Subject string `json:"subject,omitempty" yaml:"subject,omitempty"`
+	Pin     string `json:"pin,omitempty" yaml:"pin,omitempty"`
+}
+
+func printPinResult(pinCheck *pinResult) {
+	if pinCheck == nil {
+		return
+	}
+	if pinCheck.Matched {
+		fmt.Printf("Pin: matched %s (sha256/%s)\n", pinCheck.Subject, pinCheck.Pin)
+	} else {
+		fmt.Println("Pin: no certificate in the served chain matches the expected pins")
+	}
+}
+
+func printRevocation(statuses []revocation.Status) {
+	if len(statuses) == 0 {
+		return
+	}
+	fmt.Println("Revocation:")
+	for _, status := range statuses {
+		fmt.Printf("  %s\n    %s: %s", status.Subject, strings.ToUpper(status.Method), status.Status)
+		if status.Source != "" {
+			fmt.Printf(" (%s)", status.Source)
+		}
+		fmt.Println()
+		if status.RevokedAt != nil {
+			fmt.Printf("    Revoked: %s (%s)\n", status.RevokedAt.Format(time.RFC3339), status.Reason)
+		}
+		if !status.NextUpdate.IsZero() {
+			fmt.Printf("    Next Update: %s\n", status.NextUpdate.Format(time.RFC3339))
+		}
+		if status.Error != "" {
+			fmt.Printf("    Error: %s\n", status.Error)
+		}
+	}
+}
+
+func printConnection(connection details.Connection) {
+	fmt.Println("Connection:")
+	fmt.Printf("  Protocol: %s\n  Cipher Suite: %s\n", connection.Version, connection.CipherSuite)
+	if connection.NegotiatedProtocol != "" {
+		fmt.Printf("  ALPN: %s\n", connection.NegotiatedProtocol)
+	}
+	if connection.SessionResumed != nil {
+		if *connection.SessionResumed {
+			fmt.Println("  Session Resumption: supported")
+		} else {
+			fmt.Println("  Session Resumption: not supported")
+		}
+	}
+	if connection.ResumptionError != "" {
+		fmt.Printf("  Session Resumption: check failed: %s\n", connection.ResumptionError)
+	}
+	fmt.Printf("  OCSP Stapled: %s\n  SCTs: %d\n", yesNo(connection.OCSPStapled), connection.SCTs)
+	fmt.Printf("  Handshake: %v\n", connection.HandshakeDuration.Round(time.Millisecond))
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func printClientAuth(clientAuth details.ClientAuth) {
+	if !clientAuth.Requested {
+		return
+	}
+	if clientAuth.Sent {
+		fmt.Println("Client Certificate: requested, sent")
+	} else {
+		fmt.Println("Client Certificate: requested, none sent")
+	}
+	if len(clientAuth.AcceptableCAs) == 0 {
+		fmt.Println("  Acceptable CAs: any")
+		return
+	}
+	fmt.Println("  Acceptable CAs:")
+	for _, name := range clientAuth.AcceptableCAs {
+		fmt.Printf("  - %s\n", name)
+	}
+}
+
+func printLint(warnings []details.ChainWarning) {
+	if len(warnings) == 0 {
+		return
+	}
+	fmt.Println("Chain Warnings:")
+	for _, warning := range warnings {
+		fmt.Printf("  - %s: %s\n", warning.Check, warning.Detail)
+	}
+}
+
+func printCompletion(result details.Result) {
+	completion := result.Completion
+	if completion == nil {
+		return
+	}
+	fmt.Println("Served Chain:")
+	for _, cert := range details.ServedOrder(result.Chain) {
+		fmt.Printf("  - %s\n", cert.Subject)
+	}
+	fmt.Println("Completed Chain:")
+	for i, cert := range completion.Chain {
+		if i < len(result.Chain) {
+			fmt.Printf("  - %s\n", cert.Subject)
+		} else {
+			fmt.Printf("  - %s (fetched from %s)\n", cert.Subject, completion.Fetched[i-len(result.Chain)].URL)
+		}
+	}
+	if completion.Err != nil {
+		fmt.Printf("  Error: %s\n", completion.Err.Error())
+	}
+	fmt.Printf("  Verification: %s\n", completion.Verification)
+	fmt.Println("Full Chain PEM:")
+	fmt.Println(string(details.FullChainPEM(completion.Chain)))
+}
+
+func printVerification(verification details.Verification) {
+	fmt.Printf("Verification: %s\n", verification)
+	for _, problem := range verification.Problems {
+		fmt.Printf("  - %s: %s\n", problem.Reason, problem.Detail)
+	}
+	if verification.MissingIssuer != "" {
+		fmt.Printf("  Missing Issuer: %s\n", verification.MissingIssuer)
+	}
+	for i, chain := range verification.Chains {
+		fmt.Printf("  Chain %d:\n", i+1)
+		for _, subject := range chain {
+			fmt.Printf("  - %s\n", subject)
+		}
+	}
+}
+
+// printCertDetails prints the extensions with full and the PEM with showPem.
+func printCertDetails(certDetails details.CertDetails, full, showPem bool) {
+	fmt.Printf("Issuer: %s\n  Expiration Date: %v\n  Issue Date: %v\n  Serial: %x\n",
+		certDetails.Issuer,
+		certDetails.NotAfter.Format(time.RFC3339),
+		certDetails.Cert.NotBefore.Format(time.RFC3339),
+		certDetails.Cert.SerialNumber)
+	fmt.Printf("  SHA-1 Fingerprint: %s\n  SHA-256 Fingerprint: %s\n  SPKI Pin: sha256/%s\n",
+		certDetails.SHA1Fingerprint,
+		certDetails.SHA256Fingerprint,
+		certDetails.SPKIPin)
+	if len(certDetails.DNSNames) > 0 {
+		fmt.Println("  DNS Names:")
+		for _, name := range certDetails.DNSNames {
+			fmt.Printf("  - %s\n", name)
+		}
+	}
+	if full {
+		printExtensions(details.DecodeExtensions(certDetails.Cert))
+	}
+	if showPem {
+		details.DisplayPemCertificate(certDetails)
+	}
+	fmt.Println()
+}
+
+func printExtensions(ext details.Extensions) {
+	fmt.Printf("  Subject: %s\n", ext.Subject)
+	printList := func(label string, values []string) {
+		if len(values) > 0 {
+			fmt.Printf("  %s: %s\n", label, strings.Join(values, ", "))
+		}
+	}
+	printList("Key Usage", ext.KeyUsage)
+	printList("Extended Key Usage", ext.ExtKeyUsage)
+	if bc := ext.BasicConstraints; bc != nil {
+		if bc.MaxPathLen != nil {
+			fmt.Printf("  Basic Constraints: CA:%t, pathlen:%d\n", bc.CA, *bc.MaxPathLen)
+		} else {
+			fmt.Printf("  Basic Constraints: CA:%t\n", bc.CA)
+		}
+	}
+	if nc := ext.NameConstraints; nc != nil {
+		if nc.Critical {
+			fmt.Println("  Name Constraints (critical):")
+		} else {
+			fmt.Println("  Name Constraints:")
+		}
+		printList("  Permitted DNS", nc.PermittedDNSDomains)
+		printList("  Excluded DNS", nc.ExcludedDNSDomains)
+		printList("  Permitted IP", nc.PermittedIPRanges)
+		printList("  Excluded IP", nc.ExcludedIPRanges)
+		printList("  Permitted Email", nc.PermittedEmails)
+		printList("  Excluded Email", nc.ExcludedEmails)
+		printList("  Permitted URI", nc.PermittedURIDomains)
+		printList("  Excluded URI", nc.ExcludedURIDomains)
+	}
+	printList("Policies", ext.Policies)
+	printList("OCSP", ext.OCSPServers)
+	printList("CA Issuers", ext.IssuingCertificateURL)
+	printList("CRL Distribution Points", ext.CRLDistributionPoints)
+	if ext.SubjectKeyID != "" {
+		fmt.Printf("  Subject Key ID: %s\n", ext.SubjectKeyID)
+	}
+	if ext.AuthorityKeyID != "" {
+		fmt.Printf("  Authority Key ID: %s\n", ext.AuthorityKeyID)
+	}
+	printList("IP Addresses", ext.IPAddresses)
+	printList("Email Addresses", ext.EmailAddresses)
+	printList("URIs", ext.URIs)
+	if ext.MustStaple {
+		fmt.Println("  Must Staple: yes")
+	}
+	if len(ext.Other) > 0 {
+		fmt.Println("  Other Extensions:")
+		for _, other := range ext.Other {
+			label := other.OID
+			if other.Name != "" {
+				label += " " + other.Name
+			}
+			if other.Critical {
+				label += " (critical)"
+			}
+			fmt.Printf("  - %s: %s\n", label, other.Value)
+		}
+	}
+}
+
 var hostname = ""
 var port = 443
 
 var insecure = false
 
+var startTLS = ""
+
+var serverName = ""
+var connectAddress = ""
+var noSNI = false
+var timeout = details.DefaultTimeout
+
+var caFiles = make([]string, 0)
+var caDirs = make([]string, 0)
+var noSystemRoots = false
+
+var clientCertFile = ""
+var clientKeyFile = ""
+var clientPass = ""
+
+var alpn []string
+var checkResumption = false
+
+var noAIA = false
+
+var checkOCSP = false
+var checkCRL = false
+var crlCacheDir = ""
+var noCRLCache = false
+
+var pins = make([]string, 0)
+
 var displayCertPem = false
+var displayFull = false
+var outputFormat = outputText
 var detailsExample = `ssltool details --host www.example.com
-ssltool details --host www.example.com --cert`
+ssltool details --host www.example.com --cert
+ssltool details --host www.example.com --full
+ssltool details --host api.example.com --pin sha256/6z2xH7BFFjYcfil9f8E4JxexxUFCmdF5HTz2QsDcd6I=
+ssltool details --host mail.example.com --port 587 --starttls smtp
+ssltool details --host www.example.com --connect 10.0.0.5
+ssltool details --host intranet.example.com --ca-file internal-ca.pem --no-system-roots
+ssltool details --host api.example.com --client-cert client.crt --client-key client.key
+ssltool details --host intranet.example.com --ocsp --crl
+ssltool details --host www.example.com --output json | jq '.certificates[].not_after'`
 
 func init() {
 	rootCmd.AddCommand(detailsCmd)
 	detailsCmd.Example = detailsExample
 	detailsCmd.Flags().StringVar(&hostname, "host", "", "hostname to check certificate.")
 	detailsCmd.Flags().IntVar(&port, "port", 443, "port")
-	detailsCmd.Flags().BoolVarP(&insecure, "insecure", "i", false, "Don't verify certificates.")
+	detailsCmd.Flags().BoolVarP(&insecure, "insecure", "i", false, "Exit successfully even if verification fails.")
+	detailsCmd.Flags().StringVar(&startTLS, "starttls", "", "Upgrade a plain connection first ("+strings.Join(starttls.Protocols, ", ")+")")
+	detailsCmd.Flags().StringVar(&serverName, "sni", "", "Server name to send and verify instead of the host")
+	detailsCmd.Flags().StringVar(&connectAddress, "connect", "", "Address to connect to instead of resolving the host")
+	detailsCmd.Flags().BoolVar(&noSNI, "no-sni", false, "Don't send a server name")
+	detailsCmd.Flags().DurationVarP(&timeout, "timeout", "t", details.DefaultTimeout, "Connection and handshake timeout")
+	detailsCmd.Flags().StringSliceVar(&caFiles, "ca-file", []string{}, "PEM bundle of trusted CA certificates")
+	detailsCmd.Flags().StringSliceVar(&caDirs, "ca-dir", []string{}, "Directory of PEM CA certificates (e.g. hashed with c_rehash)")
+	detailsCmd.Flags().BoolVar(&noSystemRoots, "no-system-roots", false, "Only trust CAs from --ca-file and --ca-dir")
+	detailsCmd.Flags().StringVar(&clientCertFile, "client-cert", "", "Client certificate (PEM or PKCS#12) to present")
+	detailsCmd.Flags().StringVar(&clientKeyFile, "client-key", "", "Client private key (PEM) if not in --client-cert")
+	detailsCmd.Flags().StringVar(&clientPass, "client-pass", "", "PKCS#12 password (default $SSLTOOL_CLIENT_PASS)")
+	detailsCmd.Flags().StringSliceVar(&alpn, "alpn", nil, "ALPN protocols to offer, e.g. h2,http/1.1 (ignored with --starttls)")
+	detailsCmd.Flags().BoolVar(&checkResumption, "resumption", false, "Reconnect to check session resumption")
+	detailsCmd.Flags().BoolVar(&noAIA, "no-aia", false, "Don't download missing intermediates from the CA Issuers URL")
+	detailsCmd.Flags().BoolVar(&checkOCSP, "ocsp", false, "Check revocation with the stapled response or the OCSP responders")
+	detailsCmd.Flags().BoolVar(&checkCRL, "crl", false, "Check revocation with the CRL distribution points")
+	detailsCmd.Flags().StringVar(&crlCacheDir, "crl-cache", "", "Directory for downloaded CRLs (default the user cache directory)")
+	detailsCmd.Flags().BoolVar(&noCRLCache, "no-crl-cache", false, "Always download CRLs")
+	detailsCmd.Flags().StringSliceVar(&pins, "pin", []string{}, "Fail unless the served chain has one of these SPKI pins (sha256/<base64>)")
 	detailsCmd.Flags().BoolVarP(&displayCertPem, "cert", "c", false, "Print certificate in pem format.")
+	detailsCmd.Flags().BoolVar(&displayFull, "full", false, "Print the subject and all extensions.")
+	detailsCmd.Flags().StringVarP(&outputFormat, "output", "o", outputText, "Output format (text, json, yaml)")
 	err := detailsCmd.MarkFlagRequired("host")
 	if err != nil {
 		log.Fatalln("Couldn't require the hostname argument.")
@@ -5,12 +5,6 @@ package cmd
 
 import (
 	"bufio"
-	"crypto"
-	"crypto/ecdsa"
-	"crypto/ed25519"
-	"crypto/elliptic"
-	"crypto/rand"
-	"crypto/rsa"
 	"crypto/x509/pkix"
 	"fmt"
 	"io/fs"
@@ -24,13 +18,23 @@ import (
 
 var encryptKey = false
 var keyType string
+var keyKDF = gen.KDFPBKDF2
+var genPass = ""
+var genPassFile = ""
+var keyFormat = ""
+var selfSigned = false
+var days = gen.DefaultDays
+var certOut = ""
 
 // genCmd represents the gen command
 var genCmd = &cobra.Command{
 	Use:   "gen",
-	Short: "Used to generate a certificate request.",
+	Short: "Used to generate a certificate request or a self signed certificate.",
 	Long: `You can set the required parameters with the following environmental variables
-or you can enter them interactively: COUNTRY, ORG, OU, LOCALITY, and PROVINCE.`,
+or you can enter them interactively: COUNTRY, ORG, OU, LOCALITY, and PROVINCE.
+
+With --self-signed a certificate valid for --days is written to --certout
+instead of a certificate request.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		scanner := bufio.NewScanner(os.Stdin)
 
@@ -46,30 +50,9 @@ or you can enter them interactively: COUNTRY, ORG, OU, LOCALITY, and PROVINCE.`,
 		}
 
 		subj := getSubject(country, org, ou, locality, province, commonName)
-		var csrOutput gen.CsrOutputInfo
-		var key crypto.PrivateKey
-		var err error
-		switch keyType {
-		case "rsa":
-			key, err = rsa.GenerateKey(rand.Reader, bits)
-			if err != nil {
-				fmt.Println("Couldn't generate RSA private key")
-				os.Exit(1)
-			}
-		case "ecdsa":
-			key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-			if err != nil {
-				fmt.Println("Couldn't generate ECDSA private key")
-				os.Exit(1)
-			}
-		case "ed25519":
-			_, key, err = ed25519.GenerateKey(rand.Reader)
-			if err != nil {
-				fmt.Println("Couldn't generate Ed25519 private key")
-				os.Exit(1)
-			}
-		default:
-			fmt.Printf("Unsupported key type: %s\n", keyType)
+		key, err := gen.GenerateKey(keyType, bits)
+		if err != nil {
+			fmt.Println(err.Error())
 			os.Exit(1)
 		}
 
@@ -78,33 +61,75 @@ or you can enter them interactively: COUNTRY, ORG, OU, LOCALITY, and PROVINCE.`,
 			Sans:       trimStrings(sans),
 			Name:       subj,
 			PrivKey:    key,
+			KeyFormat:  keyFormat,
 		}
-
-		csrOutput, err = gen.NewCsrSecure(csrInfo)
-		if err != nil {
-			fmt.Println("Couldn't generate CSR")
-			os.Exit(1)
-		}
-		if csrOut == "-" {
-			fmt.Printf("%s\n", csrOutput.CsrPem)
-		} else {
-			err := os.WriteFile(csrOut, []byte(csrOutput.CsrPem), fs.FileMode(0600))
+		if encryptKey {
+			passphrase, err := passphraseFromFlags(genPass, genPassFile)
+			if err == nil && passphrase == "" {
+				passphrase, err = promptNewPassphrase("Key passphrase: ")
+			}
 			if err != nil {
-				log.Fatalln("Couldn't write out csr file.")
+				fmt.Println(err.Error())
+				os.Exit(1)
 			}
+			csrInfo.Passphrase = []byte(passphrase)
+			csrInfo.KDF = keyKDF
 		}
 
-		if keyOut == "-" {
-			fmt.Printf("%s\n", csrOutput.PrivateKeyPem)
-		} else {
-			err := os.WriteFile(keyOut, []byte(csrOutput.PrivateKeyPem), fs.FileMode(0600))
+		if selfSigned {
+			certOutput, err := gen.NewSelfSignedSecure(csrInfo, days)
 			if err != nil {
-				log.Fatalln("Couldn't write out key file.")
+				fmt.Println("Couldn't generate certificate: " + err.Error())
+				os.Exit(1)
 			}
+			writeOutput(certOut, []byte(certOutput.CertPem), "Couldn't write out cert file.")
+			writeKey(keyOut, certOutput.PrivateKeyPem, certOutput.PrivateKeyDer)
+			return
 		}
+
+		csrOutput, err := gen.NewCsrSecure(csrInfo)
+		if err != nil {
+			fmt.Println("Couldn't generate CSR: " + err.Error())
+			os.Exit(1)
+		}
+		writeOutput(csrOut, []byte(csrOutput.CsrPem), "Couldn't write out csr file.")
+		writeKey(keyOut, csrOutput.PrivateKeyPem, csrOutput.PrivateKeyDer)
 	},
 }
 
+// writeOutput writes PEM data to filename, or to stdout if it is "-".
+func writeOutput(filename string, data []byte, failure string) {
+	if filename == "-" {
+		fmt.Printf("%s\n", data)
+		return
+	}
+	err := os.WriteFile(filename, data, fs.FileMode(0600))
+	if err != nil {
+		log.Fatalln(failure)
+	}
+}
+
+// writeKey writes the PEM or, if set, DER key to filename.
+func writeKey(filename, keyPem string, keyDer []byte) {
+	if keyDer == nil {
+		writeOutput(filename, []byte(keyPem), "Couldn't write out key file.")
+		return
+	}
+	writeDER(filename, keyDer, "Couldn't write out key file.")
+}
+
+// writeDER is like writeOutput for binary data.
+func writeDER(filename string, data []byte, failure string) {
+	if filename == "-" {
+		os.Stdout.Write(data)
+		return
+	}
+	err := os.WriteFile(filename, data, fs.FileMode(0600))
+	if err != nil {
+		log.Fatalln(failure)
+	}
+}
+
 func promptForInfo(scan *bufio.Scanner, env, prompt string) string {
 	data, exists := os.LookupEnv(env)
 	if !exists {
@@ -159,11 +184,19 @@ func init() {
 	rootCmd.AddCommand(genCmd)
 	genCmd.Example = "LOCALITY=\"Bowling Green\" PROVINCE=\"Kentucky\" COUNTRY=\"US\" ORG=\"Example ORG\" OU=\"Example OU\" ./ssltool gen -c www.example.com"
 	genCmd.Flags().StringVarP(&commonName, "cn", "c", "", "Common name")
-	genCmd.Flags().StringSliceVarP(&sans, "sans", "s", []string{}, "Sans list. In the form www.example.com,www-prod01.example.edu")
+	genCmd.Flags().StringSliceVarP(&sans, "sans", "s", []string{}, "Sans list. In the form www.example.com,10.0.0.5,email:admin@example.com,uri:spiffe://example.org/web")
 	genCmd.Flags().StringVarP(&csrOut, "csrout", "", "-", "Csr out filename. - for stdout")
+	genCmd.Flags().StringVarP(&certOut, "certout", "", "-", "Cert out filename for --self-signed. - for stdout")
 	genCmd.Flags().StringVarP(&keyOut, "keyout", "", "-", "Key out filename. - for stdout")
 	genCmd.Flags().IntVarP(&bits, "bits", "b", 2048, "RSA bits (only for RSA key type)")
-	genCmd.Flags().StringVarP(&keyType, "key-type", "k", "rsa", "Key type (rsa, ecdsa, ed25519)")
+	genCmd.Flags().StringVarP(&keyType, "key-type", "k", gen.KeyTypeRSA, "Key type (rsa, ecdsa, ed25519)")
+	genCmd.Flags().StringVar(&keyFormat, "key-format", "", "Key encoding (pkcs1, sec1, pkcs8, der). Default: pkcs1 for RSA, sec1 for ECDSA, pkcs8 for Ed25519")
+	genCmd.Flags().BoolVar(&encryptKey, "encrypt", false, "Encrypt the key as PKCS#8 with AES-256-CBC")
+	genCmd.Flags().StringVar(&keyKDF, "kdf", gen.KDFPBKDF2, "Key derivation for --encrypt (pbkdf2, scrypt)")
+	genCmd.Flags().StringVar(&genPass, "pass", "", "Passphrase for --encrypt (default $SSLTOOL_PASS, prompted otherwise)")
+	genCmd.Flags().StringVar(&genPassFile, "pass-file", "", "Read the passphrase for --encrypt from the first line of a file")
+	genCmd.Flags().BoolVar(&selfSigned, "self-signed", false, "Generate a self signed certificate instead of a CSR")
+	genCmd.Flags().IntVar(&days, "days", gen.DefaultDays, "Days the self signed certificate is valid for")
 	err := genCmd.MarkFlagRequired("cn")
 	if err != nil {
 		log.Fatalln("Couldn't mark cn as required.")
@@ -0,0 +1,125 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"ssltool/pkg/details"
+	"ssltool/pkg/inspect"
+	"ssltool/pkg/revocation"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var inspectCmd = &cobra.Command{
+	Use:   "inspect <file>...",
+	Short: "Inspect local certificate, CSR, CRL and key files.",
+	Long: `Print the contents of PEM or DER files: certificates and bundles, certificate
+requests, CRLs, private and public keys, PKCS#7 and PKCS#12 files.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := validOutputFormat(inspectOutputFormat); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		password, err := passphraseFromFlags(inspectPass, inspectPassFile)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		reports := make([]inspect.Report, 0, len(args))
+		for _, path := range args {
+			objects, err := inspect.ParseFile(path, password)
+			if err != nil {
+				fmt.Printf("%s: %s\n", path, err.Error())
+				os.Exit(1)
+			}
+			if inspectOutputFormat != outputText {
+				reports = append(reports, inspect.NewReport(path, objects))
+				continue
+			}
+			for _, object := range objects {
+				printObject(path, object)
+			}
+		}
+		if inspectOutputFormat != outputText {
+			if err := writeStructured(os.Stdout, inspectOutputFormat, reports); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+func printObject(path string, object inspect.Object) {
+	fmt.Printf("%s: %s %s\n", path, object.Encoding, object.Kind)
+	for _, certDetails := range object.Certificates {
+		// --full prints the subject with the extensions
+		if !inspectFull {
+			fmt.Printf("Subject: %s\n", certDetails.Cert.Subject)
+		}
+		printCertDetails(certDetails, inspectFull, inspectCertPem)
+	}
+	if object.Request != nil {
+		request := inspect.NewRequestReport(object.Request)
+		signature := "invalid"
+		if request.SignatureValid {
+			signature = "valid"
+		}
+		fmt.Printf("Subject: %s\n  Key Algorithm: %s\n  Signature Algorithm: %s\n  Signature: %s\n",
+			request.Subject,
+			request.KeyAlgorithm,
+			request.SignatureAlgorithm,
+			signature)
+		for _, names := range []struct {
+			label  string
+			values []string
+		}{
+			{"DNS Names", request.DNSNames},
+			{"IP Addresses", request.IPAddresses},
+			{"Email Addresses", request.EmailAddresses},
+			{"URIs", request.URIs},
+		} {
+			if len(names.values) > 0 {
+				fmt.Printf("  %s:\n  - %s\n", names.label, strings.Join(names.values, "\n  - "))
+			}
+		}
+		fmt.Println()
+	}
+	if object.CRL != nil {
+		printCRLInfo(revocation.NewCRLInfo(object.CRL), false)
+		fmt.Println()
+	}
+	if object.Kind == inspect.KindPrivateKey || object.Kind == inspect.KindPublicKey {
+		if object.PublicKey != nil {
+			fmt.Printf("  Algorithm: %s\n", details.PublicKeyAlgorithm(object.PublicKey))
+		}
+		if object.Encrypted {
+			fmt.Println("  Encrypted: yes")
+		}
+		fmt.Println()
+	}
+}
+
+var inspectPass = ""
+var inspectPassFile = ""
+var inspectOutputFormat = outputText
+var inspectCertPem = false
+var inspectFull = false
+var inspectExample = `ssltool inspect server.crt --full
+ssltool inspect fullchain.pem server.csr server.key
+ssltool inspect client.p12 --pass secret
+ssltool inspect ca.der --output json`
+
+func init() {
+	rootCmd.AddCommand(inspectCmd)
+	inspectCmd.Example = inspectExample
+	inspectCmd.Flags().StringVar(&inspectPass, "pass", "", "Passphrase for encrypted keys and PKCS#12 (default $SSLTOOL_PASS)")
+	inspectCmd.Flags().StringVar(&inspectPassFile, "pass-file", "", "Read the passphrase from the first line of a file")
+	inspectCmd.Flags().BoolVarP(&inspectCertPem, "cert", "c", false, "Print certificates in pem format.")
+	inspectCmd.Flags().BoolVar(&inspectFull, "full", false, "Print the subject and all extensions.")
+	inspectCmd.Flags().StringVarP(&inspectOutputFormat, "output", "o", outputText, "Output format (text, json, yaml)")
+}
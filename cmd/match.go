@@ -0,0 +1,89 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"ssltool/pkg/match"
+
+	"github.com/spf13/cobra"
+)
+
+var matchCmd = &cobra.Command{
+	Use:   "match <file>...",
+	Short: "Check that private keys, CSRs and certificates belong together.",
+	Long: `Compare the public keys of any combination of private key, CSR and certificate
+files and exit with status 1 if they don't all match.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := validOutputFormat(matchOutputFormat); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		passphrase, err := passphraseFromFlags(matchPass, matchPassFile)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		var items []match.Item
+		for _, path := range args {
+			loaded, err := match.Load(path, passphrase)
+			if errors.Is(err, match.ErrPassphraseRequired) {
+				passphrase, err = promptPassphrase("Passphrase for " + path + ": ")
+				if err == nil {
+					loaded, err = match.Load(path, passphrase)
+				}
+			}
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			items = append(items, loaded...)
+		}
+		result, err := match.Compare(items)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+
+		if matchOutputFormat != outputText {
+			if err := writeStructured(os.Stdout, matchOutputFormat, result); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+		} else {
+			for _, item := range result.Items {
+				fmt.Printf("%s: %s\n  Algorithm: %s\n  SPKI Pin: sha256/%s\n", item.File, item.Kind, item.Algorithm, item.SPKIPin)
+				if item.Subject != "" {
+					fmt.Printf("  Subject: %s\n", item.Subject)
+				}
+			}
+			if result.Match {
+				fmt.Println("Match: all public keys match")
+			} else {
+				fmt.Println("Match: public keys differ")
+			}
+		}
+		if !result.Match {
+			os.Exit(1)
+		}
+	},
+}
+
+var matchPass = ""
+var matchPassFile = ""
+var matchOutputFormat = outputText
+var matchExample = `ssltool match server.key server.csr server.crt
+ssltool match encrypted.key server.crt --pass-file passphrase.txt
+ssltool match client.p12 --pass secret`
+
+func init() {
+	rootCmd.AddCommand(matchCmd)
+	matchCmd.Example = matchExample
+	matchCmd.Flags().StringVar(&matchPass, "pass", "", "Passphrase for encrypted keys and PKCS#12 (default $SSLTOOL_PASS)")
+	matchCmd.Flags().StringVar(&matchPassFile, "pass-file", "", "Read the passphrase from the first line of a file")
+	matchCmd.Flags().StringVarP(&matchOutputFormat, "output", "o", outputText, "Output format (text, json, yaml)")
+}
@@ -0,0 +1,176 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package cmd
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"ssltool/pkg/ca"
+	"ssltool/pkg/inspect"
+	"ssltool/pkg/responder"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var ocspCmd = &cobra.Command{
+	Use:   "ocsp",
+	Short: "Work with OCSP.",
+}
+
+var ocspServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run an OCSP responder for a CA.",
+	Long: `Answer OCSP requests over HTTP (GET and POST) for the certificates of one issuer.
+Statuses come from the index of a CA created with ssltool ca (--dir), an index file (--index)
+or a CRL (--crl). The index and CRL are read again when they change, so revocations show up
+without a restart. Responses are signed with a delegated responder certificate, e.g. from
+ssltool ca issue --profile ocsp-signing.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		issuer, source, err := ocspSource()
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		responderCert, err := loadCertificate(ocspResponderCert)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		responderKey, err := loadResponderKey(ocspResponderKey)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		ocspResponder, err := responder.New(issuer, responderCert, responderKey, source)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		ocspResponder.Validity = ocspValidity
+
+		server := &http.Server{
+			Addr:              ocspListen,
+			Handler:           ocspResponder,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		fmt.Printf("OCSP responder for %s listening on http://%s\n", issuer.Subject, ocspListen)
+		if err := server.ListenAndServe(); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// ocspSource returns the issuer and where statuses are looked up from the
+// --dir, --index or --crl flags.
+func ocspSource() (*x509.Certificate, responder.Source, error) {
+	if ocspCADir != "" {
+		issuer, err := ca.IssuerCertificate(ocspCADir)
+		if err != nil {
+			return nil, nil, err
+		}
+		return issuer, &responder.IndexSource{Path: filepath.Join(ocspCADir, ca.IndexFile)}, nil
+	}
+	if ocspIssuer == "" {
+		return nil, nil, errors.New("--issuer is required with --index or --crl")
+	}
+	issuer, err := loadCertificate(ocspIssuer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ocspIndex != "" {
+		return issuer, &responder.IndexSource{Path: ocspIndex}, nil
+	}
+	return issuer, &responder.CRLSource{Path: ocspCRL, Issuer: issuer}, nil
+}
+
+// loadResponderKey reads the responder key, prompting for the passphrase if
+// it is encrypted and none was given.
+func loadResponderKey(path string) (crypto.Signer, error) {
+	passphrase, err := passphraseFromFlags(ocspPass, ocspPassFile)
+	if err != nil {
+		return nil, err
+	}
+	signer, encrypted, err := parseResponderKey(path, passphrase)
+	if err == nil && signer == nil && encrypted {
+		passphrase, err = promptPassphrase("Passphrase for " + path + ": ")
+		if err == nil {
+			signer, _, err = parseResponderKey(path, passphrase)
+		}
+	}
+	if err == nil && signer == nil {
+		err = errors.New(path + ": no private key found")
+	}
+	return signer, err
+}
+
+// parseResponderKey returns the first private key in path, or whether it
+// is encrypted and could not be decrypted.
+func parseResponderKey(path, passphrase string) (crypto.Signer, bool, error) {
+	objects, err := inspect.ParseFile(path, passphrase)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, object := range objects {
+		if object.Kind != inspect.KindPrivateKey {
+			continue
+		}
+		if object.Encrypted && object.PrivateKey == nil {
+			return nil, true, nil
+		}
+		signer, ok := object.PrivateKey.(crypto.Signer)
+		if !ok {
+			return nil, false, fmt.Errorf("%s: unsupported key type %T for signing", path, object.PrivateKey)
+		}
+		return signer, false, nil
+	}
+	return nil, false, nil
+}
+
+var ocspListen = "127.0.0.1:8888"
+var ocspCADir = ""
+var ocspIndex = ""
+var ocspCRL = ""
+var ocspIssuer = ""
+var ocspResponderCert = ""
+var ocspResponderKey = ""
+var ocspPass = ""
+var ocspPassFile = ""
+var ocspValidity = responder.DefaultValidity
+
+var ocspExamples = `
+ssltool ca issue -c "OCSP Responder" --profile ocsp-signing --days 30 --certout ocsp.crt --keyout ocsp.key
+ssltool ocsp serve --dir ca --responder-cert ocsp.crt --responder-key ocsp.key --listen 127.0.0.1:8888
+ssltool ocsp serve --crl ca.crl --issuer issuing-ca.crt --responder-cert ocsp.crt --responder-key ocsp.key`
+
+func init() {
+	rootCmd.AddCommand(ocspCmd)
+	ocspCmd.AddCommand(ocspServeCmd)
+	ocspServeCmd.Example = ocspExamples
+	ocspServeCmd.Flags().StringVar(&ocspListen, "listen", "127.0.0.1:8888", "Address to listen on")
+	ocspServeCmd.Flags().StringVar(&ocspCADir, "dir", "", "CA directory created with ssltool ca init")
+	ocspServeCmd.Flags().StringVar(&ocspIndex, "index", "", "CA index file (requires --issuer)")
+	ocspServeCmd.Flags().StringVar(&ocspCRL, "crl", "", "CRL file (requires --issuer)")
+	ocspServeCmd.Flags().StringVar(&ocspIssuer, "issuer", "", "Certificate of the CA that issued the certificates")
+	ocspServeCmd.Flags().StringVar(&ocspResponderCert, "responder-cert", "", "Responder certificate with the OCSP signing usage")
+	ocspServeCmd.Flags().StringVar(&ocspResponderKey, "responder-key", "", "Responder private key")
+	ocspServeCmd.Flags().StringVar(&ocspPass, "pass", "", "Passphrase for the responder key (default $SSLTOOL_PASS)")
+	ocspServeCmd.Flags().StringVar(&ocspPassFile, "pass-file", "", "Read the passphrase from the first line of a file")
+	ocspServeCmd.Flags().DurationVar(&ocspValidity, "validity", responder.DefaultValidity, "How long responses are valid")
+	ocspServeCmd.MarkFlagsOneRequired("dir", "index", "crl")
+	ocspServeCmd.MarkFlagsMutuallyExclusive("dir", "index", "crl")
+	for _, flag := range []string{"responder-cert", "responder-key"} {
+		err := ocspServeCmd.MarkFlagRequired(flag)
+		if err != nil {
+			log.Fatalln("Couldn't mark " + flag + " as required.")
+		}
+	}
+}
@@ -0,0 +1,46 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+	outputYAML = "yaml"
+)
+
+func validOutputFormat(format string) error {
+	switch format {
+	case outputText, outputJSON, outputYAML:
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format: %s (use text, json or yaml)", format)
+	}
+}
+
+// writeStructured serializes v as JSON or YAML.
+func writeStructured(w io.Writer, format string, v any) error {
+	switch format {
+	case outputJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	case outputYAML:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(v); err != nil {
+			return err
+		}
+		return encoder.Close()
+	default:
+		return fmt.Errorf("unsupported structured output format: %s", format)
+	}
+}
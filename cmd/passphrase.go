@@ -0,0 +1,69 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// passphraseEnv is read when no passphrase flag is given.
+const passphraseEnv = "SSLTOOL_PASS"
+
+// passphraseFromFlags returns the passphrase given with a flag, read from a
+// file (first line only) or set in $SSLTOOL_PASS, in that order. It returns
+// an empty string if none is set.
+func passphraseFromFlags(value, file string) (string, error) {
+	if value != "" {
+		return value, nil
+	}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		line, _, _ := strings.Cut(string(data), "\n")
+		return strings.TrimRight(line, "\r"), nil
+	}
+	return os.Getenv(passphraseEnv), nil
+}
+
+// promptPassphrase reads a passphrase from the terminal without echoing it.
+func promptPassphrase(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errors.New("a passphrase is required; use --pass, --pass-file or $" + passphraseEnv)
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(passphrase), nil
+}
+
+// promptNewPassphrase asks for a new passphrase twice and checks that both
+// entries match.
+func promptNewPassphrase(prompt string) (string, error) {
+	passphrase, err := promptPassphrase(prompt)
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", errors.New("the passphrase must not be empty")
+	}
+	confirm, err := promptPassphrase("Verifying - " + prompt)
+	if err != nil {
+		return "", err
+	}
+	if passphrase != confirm {
+		return "", errors.New("the passphrases do not match")
+	}
+	return passphrase, nil
+}
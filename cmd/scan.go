@@ -0,0 +1,123 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"ssltool/pkg/details"
+	"ssltool/pkg/scan"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// scanCmd represents the scan command
+var scanCmd = &cobra.Command{
+	Use:   "scan [targets file]",
+	Short: "Retrieve certificate details from many hosts.",
+	Long: `Read targets (host, host:port or URL, one per line) from a file or stdin,
+retrieve their certificates concurrently and report them sorted by the soonest
+expiry. Failed targets are reported at the end instead of aborting the scan.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := validOutputFormat(scanOutputFormat); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		var input io.Reader = os.Stdin
+		if len(args) == 1 && args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			defer f.Close()
+			input = f
+		}
+		targets, err := scan.ReadTargets(input, scanPort)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+
+		roots, err := details.LoadRoots(scanCAFiles, scanCADirs, scanNoSystemRoots)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+
+		results := scan.Scan(context.Background(), targets, scan.Options{
+			Workers:  scanWorkers,
+			Timeout:  scanTimeout,
+			Retries:  scanRetries,
+			Insecure: scanInsecure,
+			Roots:    roots,
+		})
+
+		if scanOutputFormat != outputText {
+			if err := writeStructured(os.Stdout, scanOutputFormat, scan.NewReport(results)); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+		} else {
+			printScanResults(results)
+		}
+		for _, result := range results {
+			if result.Err != nil {
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+func printScanResults(results []scan.Result) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TARGET\tEXPIRES\tDAYS\tSUBJECT")
+	for _, result := range results {
+		notAfter, ok := result.NotAfter()
+		if !ok {
+			fmt.Fprintf(w, "%s\tERROR\t-\t%v\n", result.Target, result.Err)
+			continue
+		}
+		leaf := result.Chain[len(result.Chain)-1]
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n",
+			result.Target,
+			notAfter.Format(time.RFC3339),
+			int(time.Until(notAfter).Hours()/24),
+			leaf.Cert.Subject.String())
+	}
+	w.Flush()
+}
+
+var (
+	scanPort         = 443
+	scanWorkers      = 10
+	scanTimeout      = 5 * time.Second
+	scanRetries      = 1
+	scanInsecure     = false
+	scanOutputFormat = outputText
+
+	scanCAFiles       = make([]string, 0)
+	scanCADirs        = make([]string, 0)
+	scanNoSystemRoots = false
+)
+
+func init() {
+	rootCmd.AddCommand(scanCmd)
+	scanCmd.Example = `ssltool scan targets.txt
+cat targets.txt | ssltool scan --workers 50 --output json`
+	scanCmd.Flags().IntVar(&scanPort, "port", 443, "Default port for targets without one")
+	scanCmd.Flags().IntVarP(&scanWorkers, "workers", "w", 10, "Number of concurrent connections")
+	scanCmd.Flags().DurationVarP(&scanTimeout, "timeout", "t", 5*time.Second, "Timeout per connection attempt")
+	scanCmd.Flags().IntVarP(&scanRetries, "retries", "r", 1, "Retries per target after a failed attempt")
+	scanCmd.Flags().BoolVarP(&scanInsecure, "insecure", "i", false, "Don't verify certificates.")
+	scanCmd.Flags().StringSliceVar(&scanCAFiles, "ca-file", []string{}, "PEM bundle of trusted CA certificates")
+	scanCmd.Flags().StringSliceVar(&scanCADirs, "ca-dir", []string{}, "Directory of PEM CA certificates (e.g. hashed with c_rehash)")
+	scanCmd.Flags().BoolVar(&scanNoSystemRoots, "no-system-roots", false, "Only trust CAs from --ca-file and --ca-dir")
+	scanCmd.Flags().StringVarP(&scanOutputFormat, "output", "o", outputText, "Output format (text, json, yaml)")
+}
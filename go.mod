@@ -6,7 +6,11 @@ toolchain go1.24.1
 
 require (
 	github.com/spf13/cobra v1.9.1
+	github.com/youmark/pkcs8 v0.0.0-20240726163527-a2c0da244d78
+	golang.org/x/crypto v0.36.0
 	golang.org/x/term v0.30.0
+	gopkg.in/yaml.v3 v3.0.1
+	software.sslmate.com/src/go-pkcs12 v0.5.0
 )
 
 require (
@@ -0,0 +1,338 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package ca
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"os"
+	"path/filepath"
+	"ssltool/pkg/gen"
+	"time"
+
+	"github.com/youmark/pkcs8"
+)
+
+// Files in a CA directory. The intermediate is optional; when it exists it
+// signs certificates instead of the root.
+const (
+	RootCertFile         = "root.crt"
+	RootKeyFile          = "root.key"
+	IntermediateCertFile = "intermediate.crt"
+	IntermediateKeyFile  = "intermediate.key"
+	IndexFile            = "index.json"
+	ConfigFile           = "config.json"
+	CertsDir             = "certs"
+)
+
+// DefaultCADays is the validity of the root and intermediate.
+const DefaultCADays = 3650
+
+var ErrPassphraseRequired = errors.New("the CA key is encrypted; a passphrase is required")
+
+type CA struct {
+	Dir          string
+	Root         *x509.Certificate
+	Intermediate *x509.Certificate
+	Index        *Index
+	Config       Config
+	// signer is the key of Issuer().
+	signer crypto.Signer
+}
+
+type InitOptions struct {
+	// Subject of the root. The intermediate uses the same subject with
+	// IntermediateName as its common name.
+	Subject          pkix.Name
+	IntermediateName string
+	KeyType          string
+	Bits             int
+	Days             int
+	// Passphrase, if set, encrypts the CA keys with KDF. See gen.EncryptPrivateKey.
+	Passphrase []byte
+	KDF        string
+	Config     Config
+}
+
+// Config holds settings applied to every certificate the CA signs.
+type Config struct {
+	// CRLURLs are added as CRL distribution points, e.g. where the output
+	// of CRL is published.
+	CRLURLs []string `json:"crl_urls,omitempty"`
+	// OCSPURLs are added to the authority information access, e.g. where
+	// ssltool ocsp serve runs.
+	OCSPURLs []string `json:"ocsp_urls,omitempty"`
+}
+
+// Init creates a root CA, and an intermediate if opts.IntermediateName is
+// set, in dir. It refuses to overwrite an existing CA.
+func Init(dir string, opts InitOptions) (*CA, error) {
+	if opts.Subject.CommonName == "" {
+		return nil, errors.New("the CA common name must not be blank")
+	}
+	if opts.Days <= 0 {
+		return nil, errors.New("days must be positive")
+	}
+	if _, err := os.Stat(filepath.Join(dir, RootCertFile)); err == nil {
+		return nil, fmt.Errorf("a CA already exists in %s", dir)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, CertsDir), 0700); err != nil {
+		return nil, err
+	}
+
+	notBefore := time.Now().Add(-5 * time.Minute).UTC()
+	rootKey, err := newSigner(opts)
+	if err != nil {
+		return nil, err
+	}
+	rootTemplate := &x509.Certificate{
+		Subject:               opts.Subject,
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.AddDate(0, 0, opts.Days),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	if opts.IntermediateName != "" {
+		rootTemplate.MaxPathLen = 1
+	}
+	root, err := createCertificate(rootTemplate, rootTemplate, rootKey.Public(), rootKey)
+	if err != nil {
+		return nil, err
+	}
+	ca := &CA{Dir: dir, Root: root, Index: &Index{}, Config: opts.Config, signer: rootKey}
+	if err := writeKey(filepath.Join(dir, RootKeyFile), rootKey, opts); err != nil {
+		return nil, err
+	}
+	if err := writeCertificate(filepath.Join(dir, RootCertFile), root); err != nil {
+		return nil, err
+	}
+
+	if opts.IntermediateName != "" {
+		intermediateKey, err := newSigner(opts)
+		if err != nil {
+			return nil, err
+		}
+		subject := opts.Subject
+		subject.CommonName = opts.IntermediateName
+		intermediate, err := createCertificate(&x509.Certificate{
+			Subject:               subject,
+			NotBefore:             notBefore,
+			NotAfter:              root.NotAfter,
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+			MaxPathLenZero:        true,
+		}, root, intermediateKey.Public(), rootKey)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeKey(filepath.Join(dir, IntermediateKeyFile), intermediateKey, opts); err != nil {
+			return nil, err
+		}
+		if err := writeCertificate(filepath.Join(dir, IntermediateCertFile), intermediate); err != nil {
+			return nil, err
+		}
+		ca.Intermediate = intermediate
+		ca.signer = intermediateKey
+	}
+
+	if err := ca.Index.save(filepath.Join(dir, IndexFile)); err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(ca.Config, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, ConfigFile), append(data, '\n'), fs.FileMode(0644)); err != nil {
+		return nil, err
+	}
+	return ca, nil
+}
+
+// Load opens the CA in dir with the key of its issuing certificate. It
+// returns ErrPassphraseRequired if the key is encrypted and passphrase is
+// empty.
+func Load(dir string, passphrase []byte) (*CA, error) {
+	root, err := readCertificate(filepath.Join(dir, RootCertFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the CA in %s: %w", dir, err)
+	}
+	ca := &CA{Dir: dir, Root: root}
+	keyFile := RootKeyFile
+	if _, err := os.Stat(filepath.Join(dir, IntermediateCertFile)); err == nil {
+		ca.Intermediate, err = readCertificate(filepath.Join(dir, IntermediateCertFile))
+		if err != nil {
+			return nil, err
+		}
+		keyFile = IntermediateKeyFile
+	}
+	ca.signer, err = readKey(filepath.Join(dir, keyFile), passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if !publicKeysEqual(ca.signer.Public(), ca.Issuer().PublicKey) {
+		return nil, fmt.Errorf("%s does not match the CA certificate", keyFile)
+	}
+	ca.Index, err = ReadIndex(filepath.Join(dir, IndexFile))
+	if err != nil {
+		return nil, err
+	}
+	// the config is optional, e.g. for CAs created before it existed
+	if data, err := os.ReadFile(filepath.Join(dir, ConfigFile)); err == nil {
+		if err := json.Unmarshal(data, &ca.Config); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", ConfigFile, err)
+		}
+	}
+	return ca, nil
+}
+
+// IssuerCertificate reads the issuing certificate of the CA in dir without
+// its key, e.g. for an OCSP responder.
+func IssuerCertificate(dir string) (*x509.Certificate, error) {
+	path := filepath.Join(dir, IntermediateCertFile)
+	if _, err := os.Stat(path); err != nil {
+		path = filepath.Join(dir, RootCertFile)
+	}
+	return readCertificate(path)
+}
+
+// Issuer is the certificate that signs for the CA: the intermediate if there
+// is one, otherwise the root.
+func (ca *CA) Issuer() *x509.Certificate {
+	if ca.Intermediate != nil {
+		return ca.Intermediate
+	}
+	return ca.Root
+}
+
+// Chain is the issued certificate's chain up to, but excluding, the root.
+func (ca *CA) Chain(cert *x509.Certificate) []*x509.Certificate {
+	if ca.Intermediate != nil {
+		return []*x509.Certificate{cert, ca.Intermediate}
+	}
+	return []*x509.Certificate{cert}
+}
+
+func newSigner(opts InitOptions) (crypto.Signer, error) {
+	keyType := opts.KeyType
+	if keyType == "" {
+		keyType = gen.KeyTypeECDSA
+	}
+	key, err := gen.GenerateKey(keyType, opts.Bits)
+	if err != nil {
+		return nil, err
+	}
+	return key.(crypto.Signer), nil
+}
+
+func newSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	return serial, nil
+}
+
+func createCertificate(template, parent *x509.Certificate, publicKey crypto.PublicKey, signer crypto.Signer) (*x509.Certificate, error) {
+	if template.SerialNumber == nil {
+		serial, err := newSerial()
+		if err != nil {
+			return nil, err
+		}
+		template.SerialNumber = serial
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, publicKey, signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+	return x509.ParseCertificate(der)
+}
+
+func writeCertificate(path string, cert *x509.Certificate) error {
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	return os.WriteFile(path, data, fs.FileMode(0644))
+}
+
+func readCertificate(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("%s is not a PEM certificate", path)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func writeKey(path string, key crypto.Signer, opts InitOptions) error {
+	var data []byte
+	if len(opts.Passphrase) > 0 {
+		var err error
+		data, err = gen.EncryptPrivateKey(key, opts.Passphrase, opts.KDF)
+		if err != nil {
+			return err
+		}
+	} else {
+		der, pemType, err := gen.MarshalPrivateKey(key, gen.KeyFormatPKCS8)
+		if err != nil {
+			return err
+		}
+		data = pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: der})
+	}
+	return os.WriteFile(path, data, fs.FileMode(0600))
+}
+
+func readKey(path string, passphrase []byte) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM private key", path)
+	}
+	var key any
+	switch block.Type {
+	case "ENCRYPTED PRIVATE KEY":
+		if len(passphrase) == 0 {
+			return nil, ErrPassphraseRequired
+		}
+		key, err = pkcs8.ParsePKCS8PrivateKey(block.Bytes, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt %s: %w", path, err)
+		}
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s is not a PEM private key", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type in %s", path)
+	}
+	return signer, nil
+}
+
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
@@ -0,0 +1,278 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package ca
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"ssltool/pkg/gen"
+	"testing"
+	"time"
+)
+
+func newTestCA(t *testing.T, intermediate string, passphrase []byte) *CA {
+	t.Helper()
+	ca, err := Init(t.TempDir(), InitOptions{
+		Subject:          pkix.Name{CommonName: "Test Root", Organization: []string{"Test Org"}},
+		IntermediateName: intermediate,
+		KeyType:          gen.KeyTypeECDSA,
+		Days:             DefaultCADays,
+		Passphrase:       passphrase,
+	})
+	if err != nil {
+		t.Fatalf("failed to create CA: %v", err)
+	}
+	return ca
+}
+
+func newTestRequest(t *testing.T, cn string, sans ...string) *x509.CertificateRequest {
+	t.Helper()
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: cn},
+		DNSNames: sans,
+	}, mustKey(t))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatalf("failed to parse request: %v", err)
+	}
+	return csr
+}
+
+func TestInit(t *testing.T) {
+	for _, intermediate := range []string{"", "Test Issuing CA"} {
+		t.Run("intermediate="+intermediate, func(t *testing.T) {
+			ca := newTestCA(t, intermediate, nil)
+			if !ca.Root.IsCA || ca.Root.Subject.CommonName != "Test Root" {
+				t.Errorf("unexpected root: %s", ca.Root.Subject)
+			}
+			if intermediate == "" {
+				if ca.Intermediate != nil || ca.Issuer() != ca.Root {
+					t.Error("expected the root to be the issuer")
+				}
+			} else {
+				if ca.Intermediate == nil || ca.Intermediate.Subject.CommonName != intermediate {
+					t.Fatal("expected an intermediate")
+				}
+				if err := ca.Intermediate.CheckSignatureFrom(ca.Root); err != nil {
+					t.Errorf("intermediate not signed by the root: %v", err)
+				}
+				if ca.Intermediate.Subject.Organization[0] != "Test Org" {
+					t.Errorf("intermediate subject mismatch: %s", ca.Intermediate.Subject)
+				}
+			}
+
+			info, err := os.Stat(filepath.Join(ca.Dir, RootKeyFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0600 {
+				t.Errorf("root key permissions mismatch: %s", info.Mode().Perm())
+			}
+
+			loaded, err := Load(ca.Dir, nil)
+			if err != nil {
+				t.Fatalf("failed to load CA: %v", err)
+			}
+			if !loaded.Issuer().Equal(ca.Issuer()) {
+				t.Error("loaded issuer mismatch")
+			}
+
+			if _, err := Init(ca.Dir, InitOptions{Subject: pkix.Name{CommonName: "Again"}, Days: 1}); err == nil {
+				t.Error("expected an error when the CA already exists")
+			}
+		})
+	}
+}
+
+func TestLoad_Encrypted(t *testing.T) {
+	ca := newTestCA(t, "", []byte("secret"))
+	if _, err := Load(ca.Dir, nil); !errors.Is(err, ErrPassphraseRequired) {
+		t.Errorf("expected ErrPassphraseRequired, got %v", err)
+	}
+	if _, err := Load(ca.Dir, []byte("wrong")); err == nil {
+		t.Error("expected an error for a wrong passphrase")
+	}
+	if _, err := Load(ca.Dir, []byte("secret")); err != nil {
+		t.Errorf("failed to load CA: %v", err)
+	}
+}
+
+func TestSign(t *testing.T) {
+	ca := newTestCA(t, "Test Issuing CA", nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Root)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(ca.Intermediate)
+
+	tests := []struct {
+		profile string
+		usage   x509.ExtKeyUsage
+	}{
+		{ProfileServer, x509.ExtKeyUsageServerAuth},
+		{ProfileClient, x509.ExtKeyUsageClientAuth},
+		{ProfileCodeSigning, x509.ExtKeyUsageCodeSigning},
+	}
+	for _, tt := range tests {
+		t.Run(tt.profile, func(t *testing.T) {
+			cert, err := ca.Sign(newTestRequest(t, "www.example.com", "example.com"), tt.profile, 30)
+			if err != nil {
+				t.Fatalf("failed to sign: %v", err)
+			}
+			if _, err := cert.Verify(x509.VerifyOptions{
+				Roots:         roots,
+				Intermediates: intermediates,
+				KeyUsages:     []x509.ExtKeyUsage{tt.usage},
+			}); err != nil {
+				t.Errorf("failed to verify: %v", err)
+			}
+			if cert.IsCA {
+				t.Error("expected a non-CA certificate")
+			}
+			if validity := cert.NotAfter.Sub(cert.NotBefore); validity != 30*24*time.Hour {
+				t.Errorf("validity mismatch: got %s", validity)
+			}
+		})
+	}
+
+	server, err := ca.Sign(newTestRequest(t, "www.example.com", "example.com"), ProfileServer, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(server.DNSNames) != 2 || server.DNSNames[0] != "www.example.com" {
+		t.Errorf("expected the common name in the SANs, got %v", server.DNSNames)
+	}
+
+	index, err := ReadIndex(filepath.Join(ca.Dir, IndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Certificates) != 4 {
+		t.Fatalf("expected 4 index entries, got %d", len(index.Certificates))
+	}
+	entry := index.Find(ca.Index.Certificates[3].Serial)
+	if entry == nil || entry.Profile != ProfileServer || entry.Subject != "CN=www.example.com" {
+		t.Errorf("unexpected index entry: %+v", entry)
+	}
+	if _, err := os.Stat(filepath.Join(ca.Dir, CertsDir, entry.Serial+".crt")); err != nil {
+		t.Errorf("issued certificate not stored: %v", err)
+	}
+}
+
+func TestSign_Invalid(t *testing.T) {
+	ca := newTestCA(t, "", nil)
+	if _, err := ca.Sign(newTestRequest(t, "www.example.com"), "email", 30); err == nil {
+		t.Error("expected an error for an unknown profile")
+	}
+	if _, err := ca.Sign(newTestRequest(t, ""), ProfileServer, 30); err == nil {
+		t.Error("expected an error for a server certificate without names")
+	}
+	csr := newTestRequest(t, "www.example.com")
+	csr.Signature[len(csr.Signature)-1] ^= 0xff
+	if _, err := ca.Sign(csr, ProfileServer, 30); err == nil {
+		t.Error("expected an error for a bad request signature")
+	}
+
+	if _, err := ca.Sign(newTestRequest(t, "My Dev Cert"), ProfileServer, 30); err == nil {
+		t.Error("expected an error for a common name that isn't a DNS name")
+	}
+
+	cert, err := ca.Sign(newTestRequest(t, "www.example.com"), ProfileServer, 100*DefaultCADays)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cert.NotAfter.Equal(ca.Root.NotAfter) {
+		t.Errorf("expected validity to be capped at the issuer, got %s", cert.NotAfter)
+	}
+}
+
+func TestIssue(t *testing.T) {
+	ca := newTestCA(t, "", nil)
+	cert, csrOutput, err := ca.Issue(gen.CsrInputInfo{
+		CommonName: "client",
+		PrivKey:    mustKey(t),
+		KeyFormat:  gen.KeyFormatPKCS8,
+	}, ProfileClient, 30)
+	if err != nil {
+		t.Fatalf("failed to issue: %v", err)
+	}
+	if cert.Subject.CommonName != "client" || csrOutput.PrivateKeyPem == "" {
+		t.Errorf("unexpected issue result: %s", cert.Subject)
+	}
+	if ca.Index.Find(FormatSerial(cert.SerialNumber)) == nil {
+		t.Error("issued certificate missing from the index")
+	}
+}
+
+func TestIssue_SANTypes(t *testing.T) {
+	ca := newTestCA(t, "", nil)
+	cert, _, err := ca.Issue(gen.CsrInputInfo{
+		CommonName: "10.0.0.5",
+		Sans:       []string{"www.example.com", "email:admin@example.com", "spiffe://example.org/web"},
+		PrivKey:    mustKey(t),
+	}, ProfileServer, 30)
+	if err != nil {
+		t.Fatalf("failed to issue: %v", err)
+	}
+	if len(cert.IPAddresses) != 1 || !cert.IPAddresses[0].Equal(net.ParseIP("10.0.0.5")) {
+		t.Errorf("expected the common name as an IP SAN, got %v", cert.IPAddresses)
+	}
+	if len(cert.DNSNames) != 1 || cert.DNSNames[0] != "www.example.com" {
+		t.Errorf("unexpected DNS names: %v", cert.DNSNames)
+	}
+	if len(cert.EmailAddresses) != 1 || len(cert.URIs) != 1 {
+		t.Errorf("expected the email and URI SANs, got %v and %v", cert.EmailAddresses, cert.URIs)
+	}
+}
+
+func TestSign_CommonNameNotDNSName(t *testing.T) {
+	ca := newTestCA(t, "", nil)
+	cert, err := ca.Sign(newTestRequest(t, "My Dev Cert", "www.example.com"), ProfileServer, 30)
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	if len(cert.DNSNames) != 1 || cert.DNSNames[0] != "www.example.com" {
+		t.Errorf("expected only the requested DNS name, got %v", cert.DNSNames)
+	}
+}
+
+func mustKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	return key
+}
+
+func TestSign_OCSPSigning(t *testing.T) {
+	ca := newTestCA(t, "", nil)
+	ca.Config.OCSPURLs = []string{"http://ocsp.example.com"}
+	cert, err := ca.Sign(newTestRequest(t, "OCSP Responder"), ProfileOCSPSigning, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageOCSPSigning {
+		t.Errorf("unexpected extended key usage: %v", cert.ExtKeyUsage)
+	}
+	var noCheck bool
+	for _, ext := range cert.Extensions {
+		noCheck = noCheck || ext.Id.Equal(ocspNoCheck.Id)
+	}
+	if !noCheck {
+		t.Error("expected the OCSP no check extension")
+	}
+	if len(cert.OCSPServer) != 1 || cert.OCSPServer[0] != "http://ocsp.example.com" {
+		t.Errorf("unexpected OCSP servers: %v", cert.OCSPServer)
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package ca
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Index records every certificate the CA has issued.
+type Index struct {
+	// CRLNumber is the number of the last CRL created.
+	CRLNumber    int64   `json:"crl_number"`
+	Certificates []Entry `json:"certificates"`
+}
+
+type Entry struct {
+	// Serial is lowercase hex, as printed by details and inspect.
+	Serial    string    `json:"serial"`
+	Subject   string    `json:"subject"`
+	Profile   string    `json:"profile"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	// RevokedAt and Reason are set by Revoke. Reason is an RFC 5280 name.
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+}
+
+// FormatSerial formats a serial number the way the index stores it.
+func FormatSerial(serial *big.Int) string {
+	return fmt.Sprintf("%x", serial)
+}
+
+// Find returns the entry for serial, or nil if it was not issued by the CA.
+func (index *Index) Find(serial string) *Entry {
+	for i := range index.Certificates {
+		if index.Certificates[i].Serial == serial {
+			return &index.Certificates[i]
+		}
+	}
+	return nil
+}
+
+// ReadIndex reads an index file written by the CA.
+func ReadIndex(path string) (*Index, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var index Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &index, nil
+}
+
+// save replaces the index file atomically so an interrupted write cannot
+// lose issued serials.
+func (index *Index) save(path string) error {
+	if index.Certificates == nil {
+		index.Certificates = []Entry{}
+	}
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".index-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), fs.FileMode(0600)); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,103 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package ca
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"ssltool/pkg/revocation"
+	"strings"
+	"time"
+)
+
+// DefaultCRLDays is how long a CRL is valid before the next one is due.
+const DefaultCRLDays = 7
+
+// NormalizeSerial accepts a hex serial in any case, with or without a 0x
+// prefix or colons, and returns it the way the index stores it.
+func NormalizeSerial(serial string) (string, error) {
+	s := strings.ReplaceAll(strings.TrimSpace(serial), ":", "")
+	s = strings.TrimPrefix(strings.ToLower(s), "0x")
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok || n.Sign() <= 0 {
+		return "", fmt.Errorf("invalid serial number: %s", serial)
+	}
+	return FormatSerial(n), nil
+}
+
+// Revoke marks a certificate issued by the CA as revoked at the given time.
+// reason is an RFC 5280 reason name such as keyCompromise; empty means
+// unspecified.
+func (ca *CA) Revoke(serial, reason string, at time.Time) (*Entry, error) {
+	serial, err := NormalizeSerial(serial)
+	if err != nil {
+		return nil, err
+	}
+	if reason == "" {
+		reason = revocation.ReasonName(0)
+	}
+	// removeFromCRL is only meaningful in delta CRLs
+	if code, ok := revocation.ReasonCode(reason); !ok || code == 8 {
+		return nil, fmt.Errorf("invalid revocation reason: %s", reason)
+	}
+	entry := ca.Index.Find(serial)
+	if entry == nil {
+		return nil, fmt.Errorf("serial %s was not issued by this CA", serial)
+	}
+	if entry.RevokedAt != nil {
+		return nil, fmt.Errorf("serial %s was already revoked on %s", serial, entry.RevokedAt.Format(time.RFC3339))
+	}
+	revokedAt := at.UTC().Truncate(time.Second)
+	entry.RevokedAt = &revokedAt
+	entry.Reason = reason
+	if err := ca.Index.save(filepath.Join(ca.Dir, IndexFile)); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// CRL creates a CRL of every revoked certificate, signed by the issuing CA
+// and valid for days. Each CRL gets the next CRL number from the index.
+// There is no root-signed CRL, so the intermediate can't be revoked.
+func (ca *CA) CRL(now time.Time, days int) (*x509.RevocationList, error) {
+	if days <= 0 {
+		return nil, errors.New("days must be positive")
+	}
+	var entries []x509.RevocationListEntry
+	for _, entry := range ca.Index.Certificates {
+		if entry.RevokedAt == nil {
+			continue
+		}
+		serial, ok := new(big.Int).SetString(entry.Serial, 16)
+		if !ok {
+			return nil, fmt.Errorf("invalid serial number in index: %s", entry.Serial)
+		}
+		code, _ := revocation.ReasonCode(entry.Reason)
+		entries = append(entries, x509.RevocationListEntry{
+			SerialNumber:   serial,
+			RevocationTime: *entry.RevokedAt,
+			ReasonCode:     code,
+		})
+	}
+
+	ca.Index.CRLNumber++
+	thisUpdate := now.UTC().Truncate(time.Second)
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(ca.Index.CRLNumber),
+		ThisUpdate:                thisUpdate,
+		NextUpdate:                thisUpdate.AddDate(0, 0, days),
+		RevokedCertificateEntries: entries,
+	}, ca.Issuer(), ca.signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CRL: %w", err)
+	}
+	if err := ca.Index.save(filepath.Join(ca.Dir, IndexFile)); err != nil {
+		return nil, err
+	}
+	return x509.ParseRevocationList(der)
+}
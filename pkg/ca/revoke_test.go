@@ -0,0 +1,140 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package ca
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"ssltool/pkg/revocation"
+	"testing"
+	"time"
+)
+
+func TestNormalizeSerial(t *testing.T) {
+	tests := []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{"1a2b", "1a2b", false},
+		{"0x1A2B", "1a2b", false},
+		{"1A:2B", "1a2b", false},
+		{"001a2b", "1a2b", false},
+		{"xyz", "", true},
+		{"0", "", true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeSerial(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("NormalizeSerial(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	ca := newTestCA(t, "", nil)
+	cert, err := ca.Sign(newTestRequest(t, "www.example.com"), ProfileServer, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial := FormatSerial(cert.SerialNumber)
+	now := time.Now()
+
+	if _, err := ca.Revoke(serial, "bogus", now); err == nil {
+		t.Error("expected an error for an unknown reason")
+	}
+	if _, err := ca.Revoke("1234", "", now); err == nil {
+		t.Error("expected an error for a serial not issued by the CA")
+	}
+	entry, err := ca.Revoke("0x"+serial, "keyCompromise", now)
+	if err != nil {
+		t.Fatalf("failed to revoke: %v", err)
+	}
+	if entry.RevokedAt == nil || entry.Reason != "keyCompromise" {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+	if _, err := ca.Revoke(serial, "", now); err == nil {
+		t.Error("expected an error when revoking twice")
+	}
+
+	index, err := ReadIndex(filepath.Join(ca.Dir, IndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved := index.Find(serial); saved == nil || saved.RevokedAt == nil {
+		t.Errorf("revocation not saved: %+v", saved)
+	}
+}
+
+func TestCRL(t *testing.T) {
+	ca := newTestCA(t, "Test Issuing CA", nil)
+	crlPath := filepath.Join(t.TempDir(), "ca.crl")
+	ca.Config.CRLURLs = []string{"file://" + crlPath}
+	revoked, err := ca.Sign(newTestRequest(t, "revoked.example.com"), ProfileServer, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	good, err := ca.Sign(newTestRequest(t, "good.example.com"), ProfileServer, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ca.Revoke(FormatSerial(revoked.SerialNumber), "superseded", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	crl, err := ca.CRL(now, DefaultCRLDays)
+	if err != nil {
+		t.Fatalf("failed to create CRL: %v", err)
+	}
+	if err := crl.CheckSignatureFrom(ca.Intermediate); err != nil {
+		t.Errorf("CRL not signed by the issuing CA: %v", err)
+	}
+	if crl.Number.Int64() != 1 {
+		t.Errorf("CRL number mismatch: got %s", crl.Number)
+	}
+	if want := now.UTC().Truncate(time.Second).AddDate(0, 0, DefaultCRLDays); !crl.NextUpdate.Equal(want) {
+		t.Errorf("next update mismatch: got %s, want %s", crl.NextUpdate, want)
+	}
+	if len(crl.RevokedCertificateEntries) != 1 {
+		t.Fatalf("expected one revoked entry, got %d", len(crl.RevokedCertificateEntries))
+	}
+	entry := crl.RevokedCertificateEntries[0]
+	if entry.SerialNumber.Cmp(revoked.SerialNumber) != 0 || revocation.ReasonName(entry.ReasonCode) != "superseded" {
+		t.Errorf("unexpected CRL entry: %+v", entry)
+	}
+
+	if err := os.WriteFile(crlPath, crl.Raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+	status := revocation.CheckCRL(context.Background(), http.DefaultClient, good, ca.Intermediate, "", now)
+	if status.Status != revocation.StatusGood {
+		t.Errorf("expected good status, got %+v", status)
+	}
+	status = revocation.CheckCRL(context.Background(), http.DefaultClient, revoked, ca.Intermediate, "", now)
+	if status.Status != revocation.StatusRevoked {
+		t.Errorf("expected revoked status, got %+v", status)
+	}
+
+	crl, err = ca.CRL(now, DefaultCRLDays)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crl.Number.Int64() != 2 {
+		t.Errorf("expected the CRL number to increase, got %s", crl.Number)
+	}
+}
+
+func TestSign_CRLURLs(t *testing.T) {
+	ca := newTestCA(t, "", nil)
+	ca.Config.CRLURLs = []string{"http://crl.example.com/ca.crl"}
+	cert, err := ca.Sign(newTestRequest(t, "www.example.com"), ProfileServer, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.CRLDistributionPoints) != 1 || cert.CRLDistributionPoints[0] != "http://crl.example.com/ca.crl" {
+		t.Errorf("unexpected CRL distribution points: %v", cert.CRLDistributionPoints)
+	}
+}
@@ -0,0 +1,156 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package ca
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"ssltool/pkg/gen"
+	"strings"
+	"time"
+)
+
+// Certificate profiles for Sign and Issue.
+const (
+	ProfileServer      = "server"
+	ProfileClient      = "client"
+	ProfileCodeSigning = "code-signing"
+	// ProfileOCSPSigning is for delegated OCSP responders, see responder.
+	ProfileOCSPSigning = "ocsp-signing"
+)
+
+var Profiles = []string{ProfileServer, ProfileClient, ProfileCodeSigning, ProfileOCSPSigning}
+
+var profileExtKeyUsage = map[string]x509.ExtKeyUsage{
+	ProfileServer:      x509.ExtKeyUsageServerAuth,
+	ProfileClient:      x509.ExtKeyUsageClientAuth,
+	ProfileCodeSigning: x509.ExtKeyUsageCodeSigning,
+	ProfileOCSPSigning: x509.ExtKeyUsageOCSPSigning,
+}
+
+// ocspNoCheck tells clients not to check the revocation of a responder
+// certificate (RFC 6960 section 4.2.2.2.1). Its value is an ASN.1 NULL.
+var ocspNoCheck = pkix.Extension{
+	Id:    asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 5},
+	Value: []byte{0x05, 0x00},
+}
+
+// Sign issues a certificate for csr with the given profile, valid for days
+// but never beyond the issuer, and records it in the index. Only the subject
+// and SANs of the request are used; its other extensions are ignored.
+func (ca *CA) Sign(csr *x509.CertificateRequest, profile string, days int) (*x509.Certificate, error) {
+	extKeyUsage, ok := profileExtKeyUsage[profile]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile: %s (use %s)", profile, strings.Join(Profiles, ", "))
+	}
+	if days <= 0 {
+		return nil, errors.New("days must be positive")
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid certificate request signature: %w", err)
+	}
+
+	sans := gen.SANs{DNSNames: slices.Clone(csr.DNSNames), IPAddresses: slices.Clone(csr.IPAddresses)}
+	if profile == ProfileServer {
+		// clients only match against the SANs, so the common name is added to them
+		sans.AddCommonName(csr.Subject.CommonName)
+		if len(sans.DNSNames) == 0 && len(sans.IPAddresses) == 0 {
+			return nil, errors.New("server certificates need a DNS name or IP address")
+		}
+	}
+	keyUsage := x509.KeyUsageDigitalSignature
+	if _, isRSA := csr.PublicKey.(*rsa.PublicKey); isRSA && profile == ProfileServer {
+		keyUsage |= x509.KeyUsageKeyEncipherment
+	}
+
+	issuer := ca.Issuer()
+	notBefore := time.Now().Add(-5 * time.Minute).UTC()
+	notAfter := notBefore.AddDate(0, 0, days)
+	if notAfter.After(issuer.NotAfter) {
+		notAfter = issuer.NotAfter
+	}
+	serial, err := newSerial()
+	for err == nil && ca.Index.Find(FormatSerial(serial)) != nil {
+		serial, err = newSerial()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               csr.Subject,
+		DNSNames:              sans.DNSNames,
+		IPAddresses:           sans.IPAddresses,
+		EmailAddresses:        csr.EmailAddresses,
+		URIs:                  csr.URIs,
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              keyUsage,
+		ExtKeyUsage:           []x509.ExtKeyUsage{extKeyUsage},
+		BasicConstraintsValid: true,
+		CRLDistributionPoints: ca.Config.CRLURLs,
+		OCSPServer:            ca.Config.OCSPURLs,
+	}
+	if profile == ProfileOCSPSigning {
+		template.ExtraExtensions = []pkix.Extension{ocspNoCheck}
+	}
+	cert, err := createCertificate(template, issuer, csr.PublicKey, ca.signer)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := Entry{
+		Serial:    FormatSerial(cert.SerialNumber),
+		Subject:   cert.Subject.String(),
+		Profile:   profile,
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+	}
+	if err := writeCertificate(filepath.Join(ca.Dir, CertsDir, entry.Serial+".crt"), cert); err != nil {
+		return nil, err
+	}
+	ca.Index.Certificates = append(ca.Index.Certificates, entry)
+	if err := ca.Index.save(filepath.Join(ca.Dir, IndexFile)); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// Issue generates a certificate request for csrInfo and signs it. The key is
+// returned in the form requested by csrInfo.
+func (ca *CA) Issue(csrInfo gen.CsrInputInfo, profile string, days int) (*x509.Certificate, gen.CsrOutputInfo, error) {
+	csrOutput, err := gen.NewCsrSecure(csrInfo)
+	if err != nil {
+		return nil, gen.CsrOutputInfo{}, err
+	}
+	block, _ := pem.Decode([]byte(csrOutput.CsrPem))
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, gen.CsrOutputInfo{}, err
+	}
+	cert, err := ca.Sign(csr, profile, days)
+	if err != nil {
+		return nil, gen.CsrOutputInfo{}, err
+	}
+	return cert, csrOutput, nil
+}
+
+// ParseRequest reads a PEM or DER certificate request.
+func ParseRequest(data []byte) (*x509.CertificateRequest, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != "CERTIFICATE REQUEST" && block.Type != "NEW CERTIFICATE REQUEST" {
+			return nil, fmt.Errorf("expected a CERTIFICATE REQUEST, got %s", block.Type)
+		}
+		data = block.Bytes
+	}
+	return x509.ParseCertificateRequest(data)
+}
@@ -0,0 +1,142 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package check
+
+import (
+	"fmt"
+	"math"
+	"ssltool/pkg/details"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Status follows the Nagios plugin exit code convention.
+type Status int
+
+const (
+	OK Status = iota
+	Warning
+	Critical
+	Unknown
+)
+
+func (s Status) String() string {
+	switch s {
+	case OK:
+		return "OK"
+	case Warning:
+		return "WARNING"
+	case Critical:
+		return "CRITICAL"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+type Thresholds struct {
+	Warning, Critical time.Duration
+}
+
+type Result struct {
+	Status   Status
+	Message  string
+	Perfdata []string
+}
+
+// String renders the result as a single plugin output line.
+func (r Result) String() string {
+	line := fmt.Sprintf("SSL %s - %s", r.Status, r.Message)
+	if len(r.Perfdata) > 0 {
+		line += " | " + strings.Join(r.Perfdata, " ")
+	}
+	return line
+}
+
+// UnknownResult reports an error that prevented the check from running.
+func UnknownResult(err error) Result {
+	return Result{Status: Unknown, Message: err.Error()}
+}
+
+// CriticalResult reports an error talking to the endpoint.
+func CriticalResult(err error) Result {
+	return Result{Status: Critical, Message: err.Error()}
+}
+
+// Evaluate checks every certificate in the chain against the thresholds.
+// The status is that of the certificate closest to expiring.
+func Evaluate(chain []details.CertDetails, thresholds Thresholds, now time.Time) Result {
+	if len(chain) == 0 {
+		return Result{Status: Unknown, Message: "no certificates returned"}
+	}
+	result := Result{Status: OK}
+	var soonest details.CertDetails
+	for i, certDetails := range chain {
+		remaining := certDetails.NotAfter.Sub(now)
+		if i == 0 || certDetails.NotAfter.Before(soonest.NotAfter) {
+			soonest = certDetails
+		}
+		status := OK
+		switch {
+		case remaining <= thresholds.Critical:
+			status = Critical
+		case remaining <= thresholds.Warning:
+			status = Warning
+		}
+		if status > result.Status {
+			result.Status = status
+		}
+		result.Perfdata = append(result.Perfdata, fmt.Sprintf("'%s'=%d;%d;%d;;",
+			perfLabel(certDetails, i), days(remaining), days(thresholds.Warning), days(thresholds.Critical)))
+	}
+	remaining := soonest.NotAfter.Sub(now)
+	name := certName(soonest)
+	if remaining < 0 {
+		result.Message = fmt.Sprintf("%s expired %d days ago (%s)", name, -days(remaining), soonest.NotAfter.Format(time.RFC3339))
+	} else {
+		result.Message = fmt.Sprintf("%s expires in %d days (%s)", name, days(remaining), soonest.NotAfter.Format(time.RFC3339))
+	}
+	return result
+}
+
+// ParseDuration extends time.ParseDuration with a "d" suffix for days,
+// e.g. 30d. A bare number is also treated as days.
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.Atoi(s); err == nil {
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	if strings.HasSuffix(s, "d") {
+		n, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration: %s", s)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration: %s", s)
+	}
+	return d, nil
+}
+
+func days(d time.Duration) int {
+	return int(math.Floor(d.Hours() / 24))
+}
+
+func certName(certDetails details.CertDetails) string {
+	if certDetails.Cert.Subject.CommonName != "" {
+		return certDetails.Cert.Subject.CommonName
+	}
+	return certDetails.Cert.Subject.String()
+}
+
+func perfLabel(certDetails details.CertDetails, i int) string {
+	name := certDetails.Cert.Subject.CommonName
+	if name == "" {
+		return fmt.Sprintf("cert%d_days", i)
+	}
+	name = strings.NewReplacer("'", "_", "=", "_", " ", "_").Replace(name)
+	return name + "_days"
+}
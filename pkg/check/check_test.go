@@ -0,0 +1,90 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package check
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"ssltool/pkg/details"
+	"strings"
+	"testing"
+	"time"
+)
+
+func certExpiring(cn string, notAfter time.Time) details.CertDetails {
+	return details.CertDetails{
+		NotAfter: notAfter,
+		Cert: &x509.Certificate{
+			Subject:  pkix.Name{CommonName: cn},
+			NotAfter: notAfter,
+		},
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	thresholds := Thresholds{Warning: 30 * 24 * time.Hour, Critical: 7 * 24 * time.Hour}
+	day := 24 * time.Hour
+
+	tests := []struct {
+		name   string
+		chain  []details.CertDetails
+		status Status
+	}{
+		{"ok", []details.CertDetails{certExpiring("root", now.Add(3650*day)), certExpiring("leaf", now.Add(90*day))}, OK},
+		{"warning", []details.CertDetails{certExpiring("root", now.Add(3650*day)), certExpiring("leaf", now.Add(20*day))}, Warning},
+		{"critical intermediate", []details.CertDetails{certExpiring("intermediate", now.Add(3*day)), certExpiring("leaf", now.Add(20*day))}, Critical},
+		{"expired", []details.CertDetails{certExpiring("leaf", now.Add(-day))}, Critical},
+		{"empty", nil, Unknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Evaluate(tt.chain, thresholds, now)
+			if result.Status != tt.status {
+				t.Errorf("status mismatch; got %s, want %s (%s)", result.Status, tt.status, result)
+			}
+			if len(result.Perfdata) != len(tt.chain) {
+				t.Errorf("expected %d perfdata entries, got %d", len(tt.chain), len(result.Perfdata))
+			}
+		})
+	}
+}
+
+func TestResultString(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	chain := []details.CertDetails{certExpiring("www.example.com", now.Add(45*24*time.Hour))}
+	result := Evaluate(chain, Thresholds{Warning: 30 * 24 * time.Hour, Critical: 7 * 24 * time.Hour}, now)
+	want := "SSL OK - www.example.com expires in 45 days (2024-02-15T00:00:00Z) | 'www.example.com_days'=45;30;7;;"
+	if result.String() != want {
+		t.Errorf("output mismatch\n got: %s\nwant: %s", result, want)
+	}
+	if strings.Contains(result.String(), "\n") {
+		t.Error("plugin output must be a single line")
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"30d", 30 * 24 * time.Hour},
+		{"7", 7 * 24 * time.Hour},
+		{"12h", 12 * time.Hour},
+		{"1.5d", 36 * time.Hour},
+	}
+	for _, tt := range tests {
+		got, err := ParseDuration(tt.in)
+		if err != nil {
+			t.Errorf("ParseDuration(%q) returned error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseDuration(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+	if _, err := ParseDuration("soon"); err == nil {
+		t.Error("expected error for invalid duration")
+	}
+}
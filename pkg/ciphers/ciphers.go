@@ -0,0 +1,208 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package ciphers
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"ssltool/pkg/details"
+	"strings"
+	"syscall"
+)
+
+// Versions are the protocol versions enumerated, oldest first.
+var Versions = []uint16{tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12, tls.VersionTLS13}
+
+type Suite struct {
+	Name string `json:"name" yaml:"name"`
+	ID   uint16 `json:"id" yaml:"id"`
+	// Weaknesses is empty for suites considered strong.
+	Weaknesses []string `json:"weaknesses,omitempty" yaml:"weaknesses,omitempty"`
+}
+
+type VersionSupport struct {
+	Version   string `json:"version" yaml:"version"`
+	Supported bool   `json:"supported" yaml:"supported"`
+	// Weaknesses is empty for versions considered strong.
+	Weaknesses []string `json:"weaknesses,omitempty" yaml:"weaknesses,omitempty"`
+	// Suites lists the accepted cipher suites. TLS 1.3 suites can't be
+	// restricted by the client, so only the negotiated one is listed.
+	Suites []Suite `json:"suites,omitempty" yaml:"suites,omitempty"`
+}
+
+type Result struct {
+	Versions []VersionSupport `json:"versions" yaml:"versions"`
+	Grade    string           `json:"grade" yaml:"grade"`
+	Findings []string         `json:"findings,omitempty" yaml:"findings,omitempty"`
+}
+
+// Enumerate finds the protocol versions and cipher suites the server
+// accepts by repeatedly handshaking with a single version and suite
+// offered. Only suites implemented by crypto/tls can be tested.
+func Enumerate(ctx context.Context, opts details.Options) (Result, error) {
+	// Make sure the server is reachable at all so connection errors are
+	// not mistaken for unsupported versions.
+	if _, err := details.Probe(ctx, opts, func(c *tls.Config) {
+		c.MinVersion = tls.VersionTLS10
+	}); err != nil && !isHandshakeRejection(err) {
+		return Result{}, err
+	}
+
+	var result Result
+	for _, version := range Versions {
+		support := VersionSupport{
+			Version:    tls.VersionName(version),
+			Weaknesses: versionWeaknesses(version),
+		}
+		state, err := probe(ctx, opts, version, nil)
+		if err != nil {
+			if !isHandshakeRejection(err) {
+				return Result{}, err
+			}
+			result.Versions = append(result.Versions, support)
+			continue
+		}
+		support.Supported = true
+		if version == tls.VersionTLS13 {
+			support.Suites = []Suite{newSuite(state.CipherSuite)}
+			result.Versions = append(result.Versions, support)
+			continue
+		}
+		for _, id := range suitesFor(version) {
+			if _, err := probe(ctx, opts, version, []uint16{id}); err != nil {
+				if !isHandshakeRejection(err) {
+					return Result{}, err
+				}
+				continue
+			}
+			support.Suites = append(support.Suites, newSuite(id))
+		}
+		result.Versions = append(result.Versions, support)
+	}
+	result.Grade, result.Findings = Grade(result.Versions)
+	return result, nil
+}
+
+func probe(ctx context.Context, opts details.Options, version uint16, suites []uint16) (tls.ConnectionState, error) {
+	return details.Probe(ctx, opts, func(c *tls.Config) {
+		c.MinVersion = version
+		c.MaxVersion = version
+		c.CipherSuites = suites
+		// Offer every curve so a suite isn't rejected for the key exchange.
+		c.CurvePreferences = []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384, tls.CurveP521}
+	})
+}
+
+// isHandshakeRejection reports whether err means the server refused the
+// offered parameters, as opposed to a network, STARTTLS or local failure.
+// Servers either send an alert or just close the connection.
+func isHandshakeRejection(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "remote error" {
+		return true
+	}
+	var alert tls.AlertError
+	if errors.As(err, &alert) {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// suitesFor returns every suite crypto/tls implements for version.
+func suitesFor(version uint16) []uint16 {
+	var ids []uint16
+	all := append(tls.CipherSuites(), tls.InsecureCipherSuites()...)
+	for _, suite := range all {
+		for _, v := range suite.SupportedVersions {
+			if v == version {
+				ids = append(ids, suite.ID)
+				break
+			}
+		}
+	}
+	return ids
+}
+
+func newSuite(id uint16) Suite {
+	return Suite{
+		Name:       tls.CipherSuiteName(id),
+		ID:         id,
+		Weaknesses: SuiteWeaknesses(tls.CipherSuiteName(id)),
+	}
+}
+
+// SuiteWeaknesses lists why a cipher suite is considered weak.
+func SuiteWeaknesses(name string) []string {
+	var weaknesses []string
+	if strings.Contains(name, "_RC4_") {
+		weaknesses = append(weaknesses, "RC4")
+	}
+	if strings.Contains(name, "_3DES_") {
+		weaknesses = append(weaknesses, "3DES")
+	}
+	if strings.Contains(name, "_CBC_") {
+		weaknesses = append(weaknesses, "CBC mode")
+	}
+	if strings.HasPrefix(name, "TLS_RSA_") {
+		weaknesses = append(weaknesses, "RSA key exchange (no forward secrecy)")
+	}
+	return weaknesses
+}
+
+func versionWeaknesses(version uint16) []string {
+	switch version {
+	case tls.VersionTLS10, tls.VersionTLS11:
+		return []string{"deprecated protocol version"}
+	default:
+		return nil
+	}
+}
+
+// Grade rates the accepted configuration: A when only TLS 1.2+ with AEAD
+// and forward secrecy is accepted, B when CBC suites are accepted, C for
+// TLS 1.0/1.1 or RSA key exchange and F for RC4 or 3DES.
+func Grade(versions []VersionSupport) (string, []string) {
+	var findings []string
+	grade := "A"
+	worsen := func(g, finding string) {
+		if g > grade {
+			grade = g
+		}
+		for _, f := range findings {
+			if f == finding {
+				return
+			}
+		}
+		findings = append(findings, finding)
+	}
+	supported := false
+	for _, version := range versions {
+		if !version.Supported {
+			continue
+		}
+		supported = true
+		if len(version.Weaknesses) > 0 {
+			worsen("C", version.Version+" accepted")
+		}
+		for _, suite := range version.Suites {
+			for _, weakness := range suite.Weaknesses {
+				switch {
+				case weakness == "RC4" || weakness == "3DES":
+					worsen("F", weakness+" cipher suites accepted")
+				case strings.HasPrefix(weakness, "RSA key exchange"):
+					worsen("C", weakness+" accepted")
+				default:
+					worsen("B", weakness+" cipher suites accepted")
+				}
+			}
+		}
+	}
+	if !supported {
+		return "F", []string{"no protocol version accepted"}
+	}
+	return grade, findings
+}
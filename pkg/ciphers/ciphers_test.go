@@ -0,0 +1,175 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package ciphers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"ssltool/pkg/details"
+	"testing"
+	"time"
+)
+
+// startTestTLSServer starts a localhost TLS server with an RSA certificate
+// and the given version and suite restrictions.
+func startTestTLSServer(t *testing.T, configure func(*tls.Config)) string {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: priv}}}
+	configure(tlsConfig)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func supportedSuites(result Result, version string) []string {
+	for _, v := range result.Versions {
+		if v.Version == version && v.Supported {
+			names := make([]string, len(v.Suites))
+			for i, suite := range v.Suites {
+				names[i] = suite.Name
+			}
+			return names
+		}
+	}
+	return nil
+}
+
+func TestEnumerate_TLS12WithCBC(t *testing.T) {
+	addr := startTestTLSServer(t, func(c *tls.Config) {
+		c.MinVersion = tls.VersionTLS12
+		c.MaxVersion = tls.VersionTLS12
+		c.CipherSuites = []uint16{
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+		}
+	})
+	result, err := Enumerate(context.Background(), details.Options{Address: addr})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	suites := supportedSuites(result, "TLS 1.2")
+	if len(suites) != 2 {
+		t.Fatalf("expected 2 TLS 1.2 suites, got %v", suites)
+	}
+	for _, version := range []string{"TLS 1.0", "TLS 1.1", "TLS 1.3"} {
+		if supportedSuites(result, version) != nil {
+			t.Errorf("%s should not be supported", version)
+		}
+	}
+	if result.Grade != "B" {
+		t.Errorf("grade mismatch; got %s, want B (%v)", result.Grade, result.Findings)
+	}
+}
+
+func TestEnumerate_LegacyVersions(t *testing.T) {
+	addr := startTestTLSServer(t, func(c *tls.Config) {
+		c.MinVersion = tls.VersionTLS10
+		c.MaxVersion = tls.VersionTLS12
+		c.CipherSuites = []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA, tls.TLS_RSA_WITH_AES_128_GCM_SHA256}
+	})
+	result, err := Enumerate(context.Background(), details.Options{Address: addr})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if supportedSuites(result, "TLS 1.0") == nil {
+		t.Error("expected TLS 1.0 to be supported")
+	}
+	if result.Grade != "C" {
+		t.Errorf("grade mismatch; got %s, want C (%v)", result.Grade, result.Findings)
+	}
+}
+
+func TestEnumerate_TLS13Only(t *testing.T) {
+	addr := startTestTLSServer(t, func(c *tls.Config) {
+		c.MinVersion = tls.VersionTLS13
+	})
+	result, err := Enumerate(context.Background(), details.Options{Address: addr})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(supportedSuites(result, "TLS 1.3")) != 1 {
+		t.Errorf("expected the negotiated TLS 1.3 suite, got %v", result.Versions)
+	}
+	if result.Grade != "A" || len(result.Findings) != 0 {
+		t.Errorf("grade mismatch; got %s, want A (%v)", result.Grade, result.Findings)
+	}
+}
+
+func TestEnumerate_Unreachable(t *testing.T) {
+	if _, err := Enumerate(context.Background(), details.Options{Address: "127.0.0.1:1", Timeout: time.Second}); err == nil {
+		t.Error("expected error for unreachable server")
+	}
+}
+
+func TestIsHandshakeRejection(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"alert", &net.OpError{Op: "remote error", Err: errors.New("tls: protocol version not supported")}, true},
+		{"closed", fmt.Errorf("handshake failed: %w", io.EOF), true},
+		{"local", errors.New("tls: failed to verify certificate"), false},
+		{"timeout", &net.OpError{Op: "dial", Err: errors.New("i/o timeout")}, false},
+	}
+	for _, tt := range tests {
+		if got := isHandshakeRejection(tt.err); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGrade(t *testing.T) {
+	versions := []VersionSupport{{
+		Version:   "TLS 1.2",
+		Supported: true,
+		Suites:    []Suite{{Name: "TLS_RSA_WITH_3DES_EDE_CBC_SHA", Weaknesses: SuiteWeaknesses("TLS_RSA_WITH_3DES_EDE_CBC_SHA")}},
+	}}
+	grade, findings := Grade(versions)
+	if grade != "F" {
+		t.Errorf("grade mismatch; got %s, want F", grade)
+	}
+	if len(findings) != 3 {
+		t.Errorf("expected 3DES, CBC and RSA key exchange findings, got %v", findings)
+	}
+	if grade, _ := Grade([]VersionSupport{{Version: "TLS 1.2"}}); grade != "F" {
+		t.Errorf("expected F when nothing is supported, got %s", grade)
+	}
+}
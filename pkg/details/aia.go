@@ -0,0 +1,163 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package details
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxIssuerFetches bounds how many issuers CompleteChain downloads.
+const maxIssuerFetches = 5
+
+// FetchedIssuer is a certificate downloaded from a CA Issuers URL.
+type FetchedIssuer struct {
+	Cert *x509.Certificate
+	URL  string
+}
+
+// Completion is the served chain completed with the issuers found through
+// the Authority Information Access extension.
+type Completion struct {
+	// Chain is the served chain followed by the fetched issuers, leaf first.
+	Chain   []*x509.Certificate
+	Fetched []FetchedIssuer
+	// Verification is the result of verifying Chain.
+	Verification Verification
+	// Err is set when an issuer could not be fetched. Fetched holds the
+	// ones found before it.
+	Err error
+}
+
+// CompleteChain follows the CA Issuers URL from the top of the served chain
+// (leaf first) until it reaches a certificate issued by one of roots, or the
+// system roots when roots is nil, or a self-signed one.
+func CompleteChain(ctx context.Context, client *http.Client, served []*x509.Certificate, roots *x509.CertPool) ([]FetchedIssuer, error) {
+	if len(served) == 0 {
+		return nil, errors.New("no certificates to complete")
+	}
+	var fetched []FetchedIssuer
+	top := topOfChain(served)
+	for i := 0; i < maxIssuerFetches; i++ {
+		if isSelfSigned(top) || !needsIssuer(top, roots) {
+			return fetched, nil
+		}
+		issuer, err := FetchIssuer(ctx, client, top)
+		if err != nil {
+			return fetched, err
+		}
+		fetched = append(fetched, issuer)
+		top = issuer.Cert
+	}
+	return fetched, fmt.Errorf("gave up after fetching %d issuers", maxIssuerFetches)
+}
+
+// needsIssuer reports whether cert fails to chain to roots because its
+// issuer is unknown, as opposed to other problems such as expiry.
+func needsIssuer(cert *x509.Certificate, roots *x509.CertPool) bool {
+	_, err := cert.Verify(x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	var unknownAuthority x509.UnknownAuthorityError
+	return errors.As(err, &unknownAuthority)
+}
+
+// FetchIssuer downloads the certificate that signed cert from its CA Issuers
+// URLs. DER, PEM and PKCS#7 responses are accepted.
+func FetchIssuer(ctx context.Context, client *http.Client, cert *x509.Certificate) (FetchedIssuer, error) {
+	if len(cert.IssuingCertificateURL) == 0 {
+		return FetchedIssuer{}, fmt.Errorf("%s has no CA Issuers URL", cert.Subject)
+	}
+	var errs []error
+	for _, url := range cert.IssuingCertificateURL {
+		certs, err := fetchCertificates(ctx, client, url)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", url, err))
+			continue
+		}
+		for _, candidate := range certs {
+			if cert.CheckSignatureFrom(candidate) == nil {
+				return FetchedIssuer{Cert: candidate, URL: url}, nil
+			}
+		}
+		errs = append(errs, fmt.Errorf("%s: no certificate that signed %s", url, cert.Subject))
+	}
+	return FetchedIssuer{}, errors.Join(errs...)
+}
+
+func fetchCertificates(ctx context.Context, client *http.Client, url string) ([]*x509.Certificate, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, errors.New("only http and https URLs are supported")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return ParseCertificates(data)
+}
+
+// ParseCertificates parses one or more certificates encoded as PEM, DER or
+// a DER PKCS#7 bundle.
+func ParseCertificates(data []byte) ([]*x509.Certificate, error) {
+	if block, rest := pem.Decode(data); block != nil {
+		var certs []*x509.Certificate
+		for block != nil {
+			switch block.Type {
+			case "CERTIFICATE":
+				cert, err := x509.ParseCertificate(block.Bytes)
+				if err != nil {
+					return nil, err
+				}
+				certs = append(certs, cert)
+			case "PKCS7":
+				bundle, err := ParsePKCS7Certificates(block.Bytes)
+				if err != nil {
+					return nil, err
+				}
+				certs = append(certs, bundle...)
+			}
+			block, rest = pem.Decode(rest)
+		}
+		if len(certs) == 0 {
+			return nil, errors.New("no certificates found")
+		}
+		return certs, nil
+	}
+	if certs, err := x509.ParseCertificates(data); err == nil {
+		return certs, nil
+	}
+	return ParsePKCS7Certificates(data)
+}
+
+// FullChainPEM encodes chain (leaf first) for deployment. Self-signed roots
+// are left out since clients must already trust them.
+func FullChainPEM(chain []*x509.Certificate) []byte {
+	var out []byte
+	for _, cert := range chain {
+		if len(out) > 0 && isSelfSigned(cert) {
+			continue
+		}
+		out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	return out
+}
@@ -0,0 +1,223 @@
+package details
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"ssltool/pkg/internal/testcert"
+	"testing"
+)
+
+// marshalPKCS7 builds a certs-only PKCS#7 bundle like a .p7c file.
+func marshalPKCS7(t *testing.T, certs ...*x509.Certificate) []byte {
+	t.Helper()
+	var raw []byte
+	for _, cert := range certs {
+		raw = append(raw, cert.Raw...)
+	}
+	emptySet := asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true}
+	data, err := asn1.Marshal(signedData{
+		Version:          1,
+		DigestAlgorithms: emptySet,
+		ContentInfo:      asn1.RawValue{FullBytes: []byte{0x30, 0x0b, 0x06, 0x09, 0x2a, 0x86, 0x48, 0x86, 0xf7, 0x0d, 0x01, 0x07, 0x01}},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: raw},
+		SignerInfos:      emptySet,
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal signed data: %v", err)
+	}
+	der, err := asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: data},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal content info: %v", err)
+	}
+	return der
+}
+
+// startIssuerServer serves each body at its path.
+func startIssuerServer(t *testing.T, bodies map[string][]byte) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := bodies[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestParsePKCS7Certificates(t *testing.T) {
+	root, intermediate, _ := testcert.NewChain(t)
+	certs, err := ParsePKCS7Certificates(marshalPKCS7(t, intermediate.Cert, root.Cert))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(certs) != 2 || !certs[0].Equal(intermediate.Cert) || !certs[1].Equal(root.Cert) {
+		t.Errorf("unexpected certificates: %v", certs)
+	}
+	if _, err := ParsePKCS7Certificates(root.Cert.Raw); err == nil {
+		t.Error("expected an error for a certificate")
+	}
+}
+
+func TestParseCertificates(t *testing.T) {
+	root, intermediate, _ := testcert.NewChain(t)
+	bundle := append(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: intermediate.Cert.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Cert.Raw})...)
+
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"DER", root.Cert.Raw, 1},
+		{"PEM bundle", bundle, 2},
+		{"PKCS#7", marshalPKCS7(t, intermediate.Cert, root.Cert), 2},
+		{"PEM PKCS#7", pem.EncodeToMemory(&pem.Block{Type: "PKCS7", Bytes: marshalPKCS7(t, root.Cert)}), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certs, err := ParseCertificates(tt.data)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(certs) != tt.want {
+				t.Errorf("expected %d certificates, got %d", tt.want, len(certs))
+			}
+		})
+	}
+}
+
+func TestCompleteChain(t *testing.T) {
+	root := testcert.NewCA(t, "Test Root", nil)
+	bodies := map[string][]byte{}
+	server := startIssuerServer(t, bodies)
+
+	upper := testcert.CATemplate("Test Upper Intermediate")
+	upper.IssuingCertificateURL = []string{server.URL + "/root.cer"}
+	upperCA := testcert.Issue(t, upper, root)
+	lower := testcert.CATemplate("Test Lower Intermediate")
+	lower.IssuingCertificateURL = []string{server.URL + "/upper.p7c"}
+	lowerCA := testcert.Issue(t, lower, upperCA)
+	leafCert := testcert.LeafTemplate("www.example.com")
+	leafCert.IssuingCertificateURL = []string{server.URL + "/missing.cer", server.URL + "/lower.cer"}
+	leaf := testcert.Issue(t, leafCert, lowerCA)
+	bodies["/root.cer"] = root.Cert.Raw
+	bodies["/upper.p7c"] = marshalPKCS7(t, upperCA.Cert)
+	bodies["/lower.cer"] = lowerCA.Cert.Raw
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Cert)
+	fetched, err := CompleteChain(context.Background(), server.Client(), []*x509.Certificate{leaf.Cert}, roots)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fetched) != 2 {
+		t.Fatalf("expected 2 fetched issuers, got %d", len(fetched))
+	}
+	if !fetched[0].Cert.Equal(lowerCA.Cert) || fetched[0].URL != server.URL+"/lower.cer" {
+		t.Errorf("unexpected first issuer: %s from %s", fetched[0].Cert.Subject, fetched[0].URL)
+	}
+	// the root is trusted so it isn't fetched
+	if !fetched[1].Cert.Equal(upperCA.Cert) {
+		t.Errorf("unexpected second issuer: %s", fetched[1].Cert.Subject)
+	}
+
+	// without a trusted root the chain is followed up to the self-signed root
+	fetched, err = CompleteChain(context.Background(), server.Client(), []*x509.Certificate{leaf.Cert}, x509.NewCertPool())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fetched) != 3 || !fetched[2].Cert.Equal(root.Cert) {
+		t.Errorf("expected the chain to end at the root, got %d issuers", len(fetched))
+	}
+}
+
+func TestCompleteChain_NoURL(t *testing.T) {
+	_, _, leaf := testcert.NewChain(t)
+	_, err := CompleteChain(context.Background(), http.DefaultClient, []*x509.Certificate{leaf.Cert}, x509.NewCertPool())
+	if err == nil {
+		t.Error("expected an error without a CA Issuers URL")
+	}
+}
+
+func TestFullChainPEM(t *testing.T) {
+	root, intermediate, leaf := testcert.NewChain(t)
+	certs, err := ParseCertificates(FullChainPEM([]*x509.Certificate{leaf.Cert, intermediate.Cert, root.Cert}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(certs) != 2 || !certs[0].Equal(leaf.Cert) || !certs[1].Equal(intermediate.Cert) {
+		t.Errorf("expected leaf and intermediate without the root, got %d certificates", len(certs))
+	}
+}
+
+func TestRetrieve_FetchesMissingIssuers(t *testing.T) {
+	root := testcert.NewCA(t, "Test Root", nil)
+	intermediate := testcert.NewCA(t, "Test Intermediate", root)
+	server := startIssuerServer(t, map[string][]byte{"/intermediate.cer": intermediate.Cert.Raw})
+	leafCert := testcert.LeafTemplate("www.example.com")
+	leafCert.IssuingCertificateURL = []string{server.URL + "/intermediate.cer"}
+	leaf := testcert.Issue(t, leafCert, intermediate)
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{leaf.Cert.Raw}, PrivateKey: leaf.Key}},
+	})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				_ = conn.(*tls.Conn).Handshake()
+			}(conn)
+		}
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Cert)
+	result, err := Retrieve(Options{
+		Address:             ln.Addr().String(),
+		ServerName:          "www.example.com",
+		Roots:               roots,
+		FetchMissingIssuers: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Verification.Trusted || result.Verification.MissingIssuer == "" {
+		t.Fatalf("expected the served chain to be incomplete, got %v", result.Verification)
+	}
+	completion := result.Completion
+	if completion == nil {
+		t.Fatal("expected the chain to be completed")
+	}
+	if completion.Err != nil {
+		t.Fatalf("unexpected completion error: %v", completion.Err)
+	}
+	if len(completion.Chain) != 2 || !completion.Verification.Trusted {
+		t.Errorf("expected a trusted chain of 2, got %d: %v", len(completion.Chain), completion.Verification)
+	}
+
+	report := NewResultReport("www.example.com", result)
+	if report.Completion == nil || len(report.Completion.Fetched) != 1 || report.Completion.FullChainPEM == "" {
+		t.Errorf("expected completion in the report, got %+v", report.Completion)
+	}
+}
@@ -0,0 +1,95 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package details
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// ClientAuth describes the server's CertificateRequest, if it sent one.
+type ClientAuth struct {
+	Requested bool `json:"requested" yaml:"requested"`
+	// AcceptableCAs are the distinguished names of the CAs the server
+	// accepts client certificates from. Empty means any.
+	AcceptableCAs []string `json:"acceptable_cas,omitempty" yaml:"acceptable_cas,omitempty"`
+	Sent          bool     `json:"sent" yaml:"sent"`
+}
+
+func newClientAuth(request *tls.CertificateRequestInfo, sent bool) ClientAuth {
+	if request == nil {
+		return ClientAuth{}
+	}
+	clientAuth := ClientAuth{Requested: true, Sent: sent}
+	for _, rawName := range request.AcceptableCAs {
+		var rdns pkix.RDNSequence
+		if _, err := asn1.Unmarshal(rawName, &rdns); err != nil {
+			clientAuth.AcceptableCAs = append(clientAuth.AcceptableCAs, fmt.Sprintf("(unparseable name %x)", rawName))
+			continue
+		}
+		var name pkix.Name
+		name.FillFromRDNSequence(&rdns)
+		clientAuth.AcceptableCAs = append(clientAuth.AcceptableCAs, name.String())
+	}
+	return clientAuth
+}
+
+// LoadClientCertificate loads a client certificate and key from PEM files or
+// a PKCS#12 file. keyFile may be empty when the key is in certFile; password
+// is only used for PKCS#12.
+func LoadClientCertificate(certFile, keyFile, password string) (tls.Certificate, error) {
+	certData, err := os.ReadFile(certFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if !bytes.Contains(certData, []byte("-----BEGIN")) {
+		return loadPKCS12(certData, password)
+	}
+	keyData := certData
+	if keyFile != "" {
+		keyData, err = os.ReadFile(keyFile)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+	for rest := keyData; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == "ENCRYPTED PRIVATE KEY" || block.Headers["Proc-Type"] != "" {
+			return tls.Certificate{}, errors.New("encrypted private keys are not supported; use an unencrypted key or PKCS#12")
+		}
+	}
+	cert, err := tls.X509KeyPair(certData, keyData)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to load client certificate: %w", err)
+	}
+	return cert, nil
+}
+
+func loadPKCS12(data []byte, password string) (tls.Certificate, error) {
+	key, leaf, caCerts, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to decode PKCS#12: %w", err)
+	}
+	cert := tls.Certificate{
+		Certificate: [][]byte{leaf.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+	for _, caCert := range caCerts {
+		cert.Certificate = append(cert.Certificate, caCert.Raw)
+	}
+	return cert, nil
+}
@@ -0,0 +1,128 @@
+package details
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"ssltool/pkg/internal/testcert"
+	"testing"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// startClientAuthServer starts a TLS server that requires a client
+// certificate issued by clientCA and reports each handshake result.
+func startClientAuthServer(t *testing.T, clientCA *x509.Certificate) (addr string, handshakes <-chan error) {
+	t.Helper()
+	_, intermediate, leaf := testcert.NewChain(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCA)
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{leaf.Cert.Raw, intermediate.Cert.Raw},
+			PrivateKey:  leaf.Key,
+		}},
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	results := make(chan error, 1)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			results <- tls.Server(conn, tlsConfig).Handshake()
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String(), results
+}
+
+func newClientCert(t *testing.T) (ca, client *testcert.Cert) {
+	ca = testcert.NewCA(t, "Client CA", nil)
+	template := testcert.LeafTemplate("client.example.com")
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	client = testcert.Issue(t, template, ca)
+	return ca, client
+}
+
+func TestRetrieve_ReportsAcceptableCAs(t *testing.T) {
+	ca, _ := newClientCert(t)
+	addr, handshakes := startClientAuthServer(t, ca.Cert)
+
+	result, _ := Retrieve(Options{Address: addr})
+	<-handshakes
+	if !result.ClientAuth.Requested {
+		t.Fatal("expected the certificate request to be reported")
+	}
+	if result.ClientAuth.Sent {
+		t.Error("no client certificate should have been sent")
+	}
+	if len(result.ClientAuth.AcceptableCAs) != 1 || result.ClientAuth.AcceptableCAs[0] != ca.Cert.Subject.String() {
+		t.Errorf("acceptable CAs mismatch; got %v, want [%s]", result.ClientAuth.AcceptableCAs, ca.Cert.Subject)
+	}
+}
+
+func TestRetrieve_PresentsClientCertificate(t *testing.T) {
+	ca, client := newClientCert(t)
+	dir := t.TempDir()
+
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.Key")
+	writePemCerts(t, certFile, client.Cert)
+	keyDer, err := x509.MarshalPKCS8PrivateKey(client.Key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	p12File := filepath.Join(dir, "client.p12")
+	p12, err := pkcs12.Modern.Encode(client.Key, client.Cert, []*x509.Certificate{ca.Cert}, "secret")
+	if err != nil {
+		t.Fatalf("failed to encode PKCS#12: %v", err)
+	}
+	if err := os.WriteFile(p12File, p12, 0600); err != nil {
+		t.Fatalf("failed to write PKCS#12: %v", err)
+	}
+
+	tests := []struct {
+		name                        string
+		certFile, keyFile, password string
+	}{
+		{"pem", certFile, keyFile, ""},
+		{"pkcs12", p12File, "", "secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientCert, err := LoadClientCertificate(tt.certFile, tt.keyFile, tt.password)
+			if err != nil {
+				t.Fatalf("failed to load client certificate: %v", err)
+			}
+			addr, handshakes := startClientAuthServer(t, ca.Cert)
+			result, err := Retrieve(Options{Address: addr, ClientCertificate: &clientCert})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := <-handshakes; err != nil {
+				t.Errorf("server rejected client certificate: %v", err)
+			}
+			if !result.ClientAuth.Sent {
+				t.Error("expected client certificate to be reported as sent")
+			}
+		})
+	}
+
+	if _, err := LoadClientCertificate(p12File, "", "wrong"); err == nil {
+		t.Error("expected error for wrong PKCS#12 password")
+	}
+}
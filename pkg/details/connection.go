@@ -0,0 +1,63 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package details
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+)
+
+// Connection describes the negotiated TLS session.
+type Connection struct {
+	Version            string `json:"version" yaml:"version"`
+	CipherSuite        string `json:"cipher_suite" yaml:"cipher_suite"`
+	NegotiatedProtocol string `json:"alpn,omitempty" yaml:"alpn,omitempty"`
+	// SessionResumed is nil unless Options.CheckResumption was set and the
+	// reconnect succeeded.
+	SessionResumed *bool `json:"session_resumed,omitempty" yaml:"session_resumed,omitempty"`
+	// ResumptionError is set instead when the reconnect failed.
+	ResumptionError string `json:"resumption_error,omitempty" yaml:"resumption_error,omitempty"`
+	OCSPStapled     bool   `json:"ocsp_stapled" yaml:"ocsp_stapled"`
+	// SCTs counts the signed certificate timestamps sent in the TLS
+	// extension; timestamps embedded in the certificate are not included.
+	SCTs              int           `json:"scts" yaml:"scts"`
+	HandshakeDuration time.Duration `json:"-" yaml:"-"`
+	// HandshakeMillis is HandshakeDuration for the JSON and YAML reports.
+	HandshakeMillis float64 `json:"handshake_ms" yaml:"handshake_ms"`
+	// OCSPResponse is the raw stapled OCSP response, if any.
+	OCSPResponse []byte `json:"-" yaml:"-"`
+}
+
+func newConnection(state tls.ConnectionState, duration time.Duration) Connection {
+	return Connection{
+		Version:            tls.VersionName(state.Version),
+		CipherSuite:        tls.CipherSuiteName(state.CipherSuite),
+		NegotiatedProtocol: state.NegotiatedProtocol,
+		OCSPStapled:        len(state.OCSPResponse) > 0,
+		SCTs:               len(state.SignedCertificateTimestamps),
+		HandshakeDuration:  duration,
+		HandshakeMillis:    float64(duration.Microseconds()) / 1000,
+		OCSPResponse:       state.OCSPResponse,
+	}
+}
+
+// checkResumption closes the first connection and reports whether a second
+// handshake with the same session cache was resumed.
+func checkResumption(ctx context.Context, opts Options, first *handshake, configure func(*tls.Config)) (bool, error) {
+	if first.conn.ConnectionState().Version == tls.VersionTLS13 {
+		// TLS 1.3 tickets arrive after the handshake and are only
+		// processed while reading.
+		first.conn.SetReadDeadline(time.Now().Add(250 * time.Millisecond))
+		first.conn.Read(make([]byte, 1))
+	}
+	first.conn.Close()
+
+	second, err := dialTLS(ctx, opts, configure)
+	if err != nil {
+		return false, err
+	}
+	defer second.conn.Close()
+	return second.conn.ConnectionState().DidResume, nil
+}
@@ -0,0 +1,126 @@
+package details
+
+import (
+	"crypto/tls"
+	"net"
+	"ssltool/pkg/internal/testcert"
+	"testing"
+	"time"
+)
+
+func TestRetrieve_ConnectionDetails(t *testing.T) {
+	_, intermediate, leaf := testcert.NewChain(t)
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate:                 [][]byte{leaf.Cert.Raw, intermediate.Cert.Raw},
+			PrivateKey:                  leaf.Key,
+			OCSPStaple:                  []byte{0x30, 0x03, 0x0a, 0x01, 0x06},
+			SignedCertificateTimestamps: [][]byte{{0x00, 0x01}, {0x00, 0x02}},
+		}},
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				_ = conn.(*tls.Conn).Handshake()
+				// give the client time to read the session ticket
+				conn.SetReadDeadline(time.Now().Add(time.Second))
+				conn.Read(make([]byte, 1))
+			}(conn)
+		}
+	}()
+
+	result, err := Retrieve(Options{
+		Address:         ln.Addr().String(),
+		NextProtos:      []string{"h2", "http/1.1"},
+		CheckResumption: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c := result.Connection
+	if c.Version != "TLS 1.3" {
+		t.Errorf("version mismatch; got %q, want %q", c.Version, "TLS 1.3")
+	}
+	if c.CipherSuite == "" {
+		t.Error("expected a cipher suite")
+	}
+	if c.NegotiatedProtocol != "h2" {
+		t.Errorf("ALPN mismatch; got %q, want %q", c.NegotiatedProtocol, "h2")
+	}
+	if !c.OCSPStapled || len(c.OCSPResponse) == 0 {
+		t.Error("expected stapled OCSP response")
+	}
+	if c.SCTs != 2 {
+		t.Errorf("expected 2 SCTs, got %d", c.SCTs)
+	}
+	if c.HandshakeDuration <= 0 {
+		t.Error("expected handshake duration to be measured")
+	}
+	if c.SessionResumed == nil || !*c.SessionResumed {
+		t.Errorf("expected session resumption, got %v", c.SessionResumed)
+	}
+}
+
+func TestRetrieve_ResumptionCheckFails(t *testing.T) {
+	_, _, leaf := testcert.NewChain(t)
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{leaf.Cert.Raw}, PrivateKey: leaf.Key}},
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	// accept a single connection so the reconnect is refused
+	go func() {
+		conn, err := ln.Accept()
+		ln.Close()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = conn.(*tls.Conn).Handshake()
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		conn.Read(make([]byte, 1))
+	}()
+
+	result, err := Retrieve(Options{Address: ln.Addr().String(), CheckResumption: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Chain) != 1 {
+		t.Errorf("expected the served chain, got %d certificates", len(result.Chain))
+	}
+	if result.Connection.SessionResumed != nil {
+		t.Errorf("expected no resumption result, got %v", *result.Connection.SessionResumed)
+	}
+	if result.Connection.ResumptionError == "" {
+		t.Error("expected the resumption error to be reported")
+	}
+}
+
+func TestRetrieve_ResumptionNotChecked(t *testing.T) {
+	addr, _, cleanup := startTestTLSServer(t)
+	defer cleanup()
+
+	result, err := Retrieve(Options{Address: addr})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Connection.SessionResumed != nil {
+		t.Error("resumption should not be reported unless checked")
+	}
+	if result.Connection.NegotiatedProtocol != "" || result.Connection.OCSPStapled {
+		t.Errorf("unexpected connection details: %+v", result.Connection)
+	}
+}
@@ -5,11 +5,18 @@ package details
 
 import (
 	"context"
+	"crypto/sha1"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"ssltool/pkg/starttls"
+	"strings"
 	"time"
 )
 
@@ -18,34 +25,292 @@ type CertDetails struct {
 	Issuer   string
 	DNSNames []string
 	Cert     *x509.Certificate
+	// SHA1Fingerprint and SHA256Fingerprint are hex hashes of the
+	// certificate. SPKIPin is the base64 SHA-256 hash of its public key as
+	// used for HPKP and mobile app pinning.
+	SHA1Fingerprint   string
+	SHA256Fingerprint string
+	SPKIPin           string
 }
 
-func RetrieveCertDetails(address string, insecure bool) ([]CertDetails, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: insecure,
+// NewCertDetails fills in CertDetails for cert.
+func NewCertDetails(cert *x509.Certificate) CertDetails {
+	sha1Sum := sha1.Sum(cert.Raw)
+	sha256Sum := sha256.Sum256(cert.Raw)
+	return CertDetails{
+		NotAfter:          cert.NotAfter,
+		Issuer:            cert.Issuer.String(),
+		DNSNames:          cert.DNSNames,
+		Cert:              cert,
+		SHA1Fingerprint:   hex.EncodeToString(sha1Sum[:]),
+		SHA256Fingerprint: hex.EncodeToString(sha256Sum[:]),
+		SPKIPin:           SPKIPin(cert),
 	}
-	d := tls.Dialer{Config: tlsConfig}
-	conn, err := d.DialContext(ctx, "tcp", address)
-	cancel()
+}
+
+// DefaultTimeout bounds the dial and handshake when Options.Timeout is zero.
+const DefaultTimeout = 5 * time.Second
+
+type Options struct {
+	// Address is the host:port to check. Its host is used for SNI and
+	// hostname verification unless ServerName is set.
+	Address string
+	// ConnectAddress dials a different host or IP, e.g. one node behind a
+	// load balancer. The port from Address is used when it has none.
+	ConnectAddress string
+	ServerName     string
+	// NoSNI omits the server name extension from the ClientHello. The
+	// certificate is still verified against the expected name.
+	NoSNI   bool
+	Timeout time.Duration
+	// Roots is the trust store used for verification; nil means the
+	// system roots. See LoadRoots.
+	Roots *x509.CertPool
+	// NextProtos are the ALPN protocols to offer, e.g. h2 and http/1.1.
+	NextProtos []string
+	// CheckResumption reconnects with the session from the first handshake
+	// to find out whether the server resumes sessions.
+	CheckResumption bool
+	// ClientCertificate is presented if the server requests one. See
+	// LoadClientCertificate.
+	ClientCertificate *tls.Certificate
+	// Insecure makes RetrieveCertDetails return untrusted chains instead
+	// of an error.
+	Insecure bool
+	// StartTLS upgrades a plain connection with the given protocol (see
+	// starttls.Protocols) before the TLS handshake.
+	StartTLS string
+	// FetchMissingIssuers makes Retrieve download the issuers the server
+	// did not send from their CA Issuers URLs. See CompleteChain.
+	FetchMissingIssuers bool
+}
+
+// Result is everything learned from one connection.
+type Result struct {
+	// Chain is in the same order as RetrieveCertDetails returns it.
+	Chain        []CertDetails
+	Verification Verification
+	// Lint lists problems with how the chain was served. See LintChain.
+	Lint       []ChainWarning
+	ClientAuth ClientAuth
+	Connection Connection
+	// Completion is set when issuers were missing from the served chain
+	// and Options.FetchMissingIssuers is set.
+	Completion *Completion
+}
+
+// RetrieveCertDetails returns the served chain. Unless opts.Insecure is set
+// an untrusted chain is returned as a *tls.CertificateVerificationError.
+func RetrieveCertDetails(opts Options) ([]CertDetails, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+	return RetrieveCertDetailsContext(ctx, opts)
+}
+
+// RetrieveCertDetailsContext is like RetrieveCertDetails but the dial and
+// handshake are bounded by ctx. opts.Timeout is ignored.
+func RetrieveCertDetailsContext(ctx context.Context, opts Options) ([]CertDetails, error) {
+	result, err := RetrieveContext(ctx, opts)
 	if err != nil {
 		return []CertDetails{}, err
 	}
-	if client, ok := conn.(*tls.Conn); ok {
-		certificates := client.ConnectionState().PeerCertificates
-		details := make([]CertDetails, len(certificates))
-		for i, cert := range certificates {
-			details[len(certificates)-i-1] = CertDetails{
-				NotAfter: cert.NotAfter,
-				Issuer:   cert.Issuer.String(),
-				DNSNames: cert.DNSNames,
-				Cert:     cert,
+	if !opts.Insecure && !result.Verification.Trusted {
+		return []CertDetails{}, &tls.CertificateVerificationError{
+			UnverifiedCertificates: ServedOrder(result.Chain),
+			Err:                    result.Verification.Err,
+		}
+	}
+	return result.Chain, nil
+}
+
+// Retrieve always fetches the served chain and verifies it separately, so
+// an untrusted chain is reported in Result.Verification rather than as an
+// error. opts.Insecure is ignored.
+func Retrieve(opts Options) (Result, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+	return RetrieveContext(ctx, opts)
+}
+
+// RetrieveContext is like Retrieve but the dial and handshake are bounded
+// by ctx. opts.Timeout is ignored. If the handshake fails after the server
+// requested a client certificate, Result.ClientAuth is still filled in.
+func RetrieveContext(ctx context.Context, opts Options) (Result, error) {
+	var request *tls.CertificateRequestInfo
+	var sessionCache tls.ClientSessionCache
+	if opts.CheckResumption {
+		sessionCache = tls.NewLRUClientSessionCache(1)
+	}
+	configure := func(tlsConfig *tls.Config) {
+		tlsConfig.ClientSessionCache = sessionCache
+		tlsConfig.GetClientCertificate = func(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			request = info
+			if opts.ClientCertificate != nil {
+				return opts.ClientCertificate, nil
 			}
+			return &tls.Certificate{}, nil
+		}
+	}
+	hs, err := dialTLS(ctx, opts, configure)
+	clientAuth := newClientAuth(request, opts.ClientCertificate != nil)
+	if err != nil {
+		return Result{ClientAuth: clientAuth}, err
+	}
+	state := hs.conn.ConnectionState()
+	connection := newConnection(state, hs.duration)
+	if opts.CheckResumption {
+		if resumed, err := checkResumption(ctx, opts, hs, configure); err != nil {
+			connection.ResumptionError = err.Error()
+		} else {
+			connection.SessionResumed = &resumed
+		}
+	} else {
+		hs.conn.Close()
+	}
+
+	certificates := state.PeerCertificates
+	result := Result{
+		Chain:        chainDetails(certificates),
+		Verification: Verify(certificates, hs.serverName, opts.Roots, time.Now()),
+		Lint:         LintChain(certificates),
+		ClientAuth:   clientAuth,
+		Connection:   connection,
+	}
+	if opts.FetchMissingIssuers && result.Verification.MissingIssuer != "" {
+		fetched, err := CompleteChain(ctx, http.DefaultClient, certificates, opts.Roots)
+		chain := append([]*x509.Certificate{}, certificates...)
+		for _, issuer := range fetched {
+			chain = append(chain, issuer.Cert)
+		}
+		result.Completion = &Completion{
+			Chain:        chain,
+			Fetched:      fetched,
+			Verification: Verify(chain, hs.serverName, opts.Roots, time.Now()),
+			Err:          err,
+		}
+	}
+	return result, nil
+}
+
+// chainDetails converts certificates in served order (leaf first) to the
+// order RetrieveCertDetails returns.
+func chainDetails(certificates []*x509.Certificate) []CertDetails {
+	details := make([]CertDetails, len(certificates))
+	for i, cert := range certificates {
+		details[len(certificates)-i-1] = NewCertDetails(cert)
+	}
+	return details
+}
+
+// Probe performs a single handshake with the tls.Config adjusted by
+// configure, e.g. to restrict versions or cipher suites, and returns the
+// negotiated state. The peer is not verified. The handshake is bounded by
+// opts.Timeout.
+func Probe(ctx context.Context, opts Options, configure func(*tls.Config)) (tls.ConnectionState, error) {
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout())
+	defer cancel()
+	hs, err := dialTLS(ctx, opts, configure)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer hs.conn.Close()
+	return hs.conn.ConnectionState(), nil
+}
+
+func (opts Options) timeout() time.Duration {
+	if opts.Timeout <= 0 {
+		return DefaultTimeout
+	}
+	return opts.Timeout
+}
+
+type handshake struct {
+	conn *tls.Conn
+	// serverName is the name the chain should be verified against.
+	serverName string
+	duration   time.Duration
+}
+
+// dialTLS connects and completes the handshake without verifying the peer.
+// configure, if not nil, can adjust the tls.Config before the handshake.
+func dialTLS(ctx context.Context, opts Options, configure func(*tls.Config)) (*handshake, error) {
+	host, port, err := net.SplitHostPort(opts.Address)
+	if err != nil {
+		return nil, err
+	}
+	dialAddress := opts.Address
+	if opts.ConnectAddress != "" {
+		dialAddress = opts.ConnectAddress
+		if _, _, err := net.SplitHostPort(dialAddress); err != nil {
+			dialAddress = net.JoinHostPort(strings.Trim(dialAddress, "[]"), port)
+		}
+	}
+	serverName := host
+	if opts.ServerName != "" {
+		serverName = opts.ServerName
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true,
+		NextProtos:         opts.NextProtos,
+	}
+	if opts.NoSNI {
+		tlsConfig.ServerName = ""
+	}
+	if configure != nil {
+		configure(tlsConfig)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", dialAddress)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if opts.StartTLS != "" {
+		if err := starttls.Upgrade(conn, opts.StartTLS, serverName); err != nil {
+			conn.Close()
+			return nil, err
 		}
-		return details, nil
 	}
-	return nil, errors.New("could not create TLS connect")
+	client := tls.Client(conn, tlsConfig)
+	start := time.Now()
+	if err := client.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	duration := time.Since(start)
+	conn.SetDeadline(time.Time{})
+	return &handshake{conn: client, serverName: serverName, duration: duration}, nil
+}
+
+// RevocationChain is the chain to check for revocation, leaf first: the
+// verified chain including its root if there is one, otherwise the chain
+// completed from AIA or the served chain.
+func (r Result) RevocationChain() []*x509.Certificate {
+	if r.Verification.VerifiedChain != nil {
+		return r.Verification.VerifiedChain
+	}
+	if r.Completion != nil {
+		if r.Completion.Verification.VerifiedChain != nil {
+			return r.Completion.Verification.VerifiedChain
+		}
+		return r.Completion.Chain
+	}
+	return ServedOrder(r.Chain)
+}
 
+// ServedOrder returns the certificates in the order the server sent them,
+// leaf first.
+func ServedOrder(chain []CertDetails) []*x509.Certificate {
+	certs := make([]*x509.Certificate, len(chain))
+	for i, certDetails := range chain {
+		certs[len(chain)-i-1] = certDetails.Cert
+	}
+	return certs
 }
 
 func DisplayPemCertificate(details CertDetails) error {
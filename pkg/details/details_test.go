@@ -1,13 +1,18 @@
 package details
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"fmt"
 	"math/big"
+	"net"
 	"testing"
 	"time"
 )
@@ -70,12 +75,12 @@ func TestRetrieveCertDetails_LocalTLS(t *testing.T) {
 	defer cleanup()
 
 	// connecting with strict verification should fail
-	if _, err := RetrieveCertDetails(addr, false); err == nil {
+	if _, err := RetrieveCertDetails(Options{Address: addr}); err == nil {
 		t.Error("expected error with invalid/self-signed cert and insecure=false")
 	}
 
 	// insecure=true should succeed
-	detailsList, err := RetrieveCertDetails(addr, true)
+	detailsList, err := RetrieveCertDetails(Options{Address: addr, Insecure: true})
 	if err != nil {
 		t.Fatalf("expected success with insecure=true, got %v", err)
 	}
@@ -104,8 +109,222 @@ func TestRetrieveCertDetails_LocalTLS(t *testing.T) {
 
 func TestRetrieveCertDetails_InvalidHost(t *testing.T) {
 	// connect to a non-listening address
-	_, err := RetrieveCertDetails("127.0.0.1:0", true)
+	_, err := RetrieveCertDetails(Options{Address: "127.0.0.1:0", Insecure: true})
 	if err == nil {
 		t.Fatal("expected error when connecting to invalid host")
 	}
 }
+
+func TestNewReport(t *testing.T) {
+	addr, cert, cleanup := startTestTLSServer(t)
+	defer cleanup()
+
+	detailsList, err := RetrieveCertDetails(Options{Address: addr, Insecure: true})
+	if err != nil {
+		t.Fatalf("expected success with insecure=true, got %v", err)
+	}
+	report := NewReport(addr, detailsList)
+	if report.SchemaVersion != SchemaVersion {
+		t.Errorf("schema version mismatch; got %d, want %d", report.SchemaVersion, SchemaVersion)
+	}
+	if len(report.Certificates) != 1 {
+		t.Fatalf("expected 1 certificate in report, got %d", len(report.Certificates))
+	}
+	c := report.Certificates[0]
+	if c.Serial != "2a" {
+		t.Errorf("serial mismatch; got %q, want %q", c.Serial, "2a")
+	}
+	if c.Subject != cert.Subject.String() {
+		t.Errorf("subject mismatch; got %q, want %q", c.Subject, cert.Subject.String())
+	}
+	if c.KeyAlgorithm != "RSA-2048" {
+		t.Errorf("key algorithm mismatch; got %q, want %q", c.KeyAlgorithm, "RSA-2048")
+	}
+	if len(c.Fingerprints.SHA256) != 64 {
+		t.Errorf("expected hex SHA-256 fingerprint, got %q", c.Fingerprints.SHA256)
+	}
+	block, _ := pem.Decode([]byte(c.PEM))
+	if block == nil || !bytes.Equal(block.Bytes, cert.Raw) {
+		t.Error("PEM does not round-trip to the served certificate")
+	}
+}
+
+func TestRetrieveCertDetails_StartTLS(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(7),
+		Subject:      pkix.Name{CommonName: "mail.localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	derBytes, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{derBytes}, PrivateKey: priv}}}
+
+	// plain listener speaking just enough SMTP to upgrade
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		fmt.Fprint(conn, "220 localhost ESMTP\r\n")
+		r.ReadString('\n')
+		fmt.Fprint(conn, "250-localhost\r\n250 STARTTLS\r\n")
+		r.ReadString('\n')
+		fmt.Fprint(conn, "220 go ahead\r\n")
+		_ = tls.Server(conn, tlsConfig).Handshake()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	detailsList, err := RetrieveCertDetailsContext(ctx, Options{Address: ln.Addr().String(), StartTLS: "smtp", Insecure: true})
+	if err != nil {
+		t.Fatalf("expected success over STARTTLS, got %v", err)
+	}
+	if len(detailsList) != 1 || detailsList[0].Cert.SerialNumber.Int64() != 7 {
+		t.Errorf("unexpected chain returned over STARTTLS: %+v", detailsList)
+	}
+}
+
+// startSNIRecorder starts a TLS server that reports the SNI name of each
+// ClientHello on the returned channel.
+func startSNIRecorder(t *testing.T) (addr string, serverNames <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	derBytes, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	names := make(chan string, 1)
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{derBytes}, PrivateKey: priv}},
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			names <- hello.ServerName
+			return nil, nil
+		},
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = tls.Server(conn, tlsConfig).Handshake()
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String(), names
+}
+
+func TestRetrieveCertDetails_ServerNameAndConnect(t *testing.T) {
+	addr, serverNames := startSNIRecorder(t)
+	_, port, _ := net.SplitHostPort(addr)
+
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{"sni override", Options{Address: addr, ServerName: "sni.example.com", Insecure: true}, "sni.example.com"},
+		{"connect address", Options{Address: "www.example.com:" + port, ConnectAddress: "127.0.0.1", Insecure: true}, "www.example.com"},
+		{"no sni", Options{Address: "www.example.com:" + port, ConnectAddress: "127.0.0.1", NoSNI: true, Insecure: true}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := RetrieveCertDetails(tt.opts); err != nil {
+				t.Fatalf("expected success, got %v", err)
+			}
+			if got := <-serverNames; got != tt.want {
+				t.Errorf("server saw SNI %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// without --insecure the chain is still verified when SNI is omitted
+	_, err := RetrieveCertDetails(Options{Address: "www.example.com:" + port, ConnectAddress: "127.0.0.1", NoSNI: true})
+	<-serverNames
+	if err == nil {
+		t.Error("expected verification error with NoSNI and an untrusted certificate")
+	}
+}
+
+func TestRetrieveCertDetails_Timeout(t *testing.T) {
+	// accept connections but never answer the handshake
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		// the connections are held open until the listener is closed
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	start := time.Now()
+	_, err = RetrieveCertDetails(Options{Address: ln.Addr().String(), Timeout: 200 * time.Millisecond, Insecure: true})
+	if err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("timeout not honored; took %v", elapsed)
+	}
+}
+
+func TestRetrieve_ReportsVerification(t *testing.T) {
+	addr, _, cleanup := startTestTLSServer(t)
+	defer cleanup()
+
+	result, err := Retrieve(Options{Address: addr})
+	if err != nil {
+		t.Fatalf("expected chain despite untrusted certificate, got %v", err)
+	}
+	if len(result.Chain) != 1 {
+		t.Fatalf("expected 1 cert, got %d", len(result.Chain))
+	}
+	if result.Verification.Trusted {
+		t.Error("expected self-signed certificate to be untrusted")
+	}
+	// the certificate is for localhost but was requested as 127.0.0.1
+	if !result.Verification.hasProblem(ReasonHostnameMismatch) || !result.Verification.hasProblem(ReasonUnknownAuthority) {
+		t.Errorf("unexpected problems: %v", result.Verification.Problems)
+	}
+}
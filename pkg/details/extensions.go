@@ -0,0 +1,247 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package details
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"strings"
+)
+
+// Extensions is the decoded form of a certificate's subject and extensions.
+type Extensions struct {
+	Subject               string            `json:"subject" yaml:"subject"`
+	KeyUsage              []string          `json:"key_usage,omitempty" yaml:"key_usage,omitempty"`
+	ExtKeyUsage           []string          `json:"ext_key_usage,omitempty" yaml:"ext_key_usage,omitempty"`
+	BasicConstraints      *BasicConstraints `json:"basic_constraints,omitempty" yaml:"basic_constraints,omitempty"`
+	NameConstraints       *NameConstraints  `json:"name_constraints,omitempty" yaml:"name_constraints,omitempty"`
+	Policies              []string          `json:"policies,omitempty" yaml:"policies,omitempty"`
+	OCSPServers           []string          `json:"ocsp_servers,omitempty" yaml:"ocsp_servers,omitempty"`
+	IssuingCertificateURL []string          `json:"issuing_certificate_urls,omitempty" yaml:"issuing_certificate_urls,omitempty"`
+	CRLDistributionPoints []string          `json:"crl_distribution_points,omitempty" yaml:"crl_distribution_points,omitempty"`
+	SubjectKeyID          string            `json:"subject_key_id,omitempty" yaml:"subject_key_id,omitempty"`
+	AuthorityKeyID        string            `json:"authority_key_id,omitempty" yaml:"authority_key_id,omitempty"`
+	DNSNames              []string          `json:"dns_names,omitempty" yaml:"dns_names,omitempty"`
+	IPAddresses           []string          `json:"ip_addresses,omitempty" yaml:"ip_addresses,omitempty"`
+	EmailAddresses        []string          `json:"email_addresses,omitempty" yaml:"email_addresses,omitempty"`
+	URIs                  []string          `json:"uris,omitempty" yaml:"uris,omitempty"`
+	MustStaple            bool              `json:"must_staple" yaml:"must_staple"`
+	// Other lists the extensions not decoded above.
+	Other []OtherExtension `json:"other,omitempty" yaml:"other,omitempty"`
+}
+
+type BasicConstraints struct {
+	CA bool `json:"ca" yaml:"ca"`
+	// MaxPathLen is nil when there is no limit.
+	MaxPathLen *int `json:"max_path_len,omitempty" yaml:"max_path_len,omitempty"`
+}
+
+type NameConstraints struct {
+	Critical            bool     `json:"critical" yaml:"critical"`
+	PermittedDNSDomains []string `json:"permitted_dns_domains,omitempty" yaml:"permitted_dns_domains,omitempty"`
+	ExcludedDNSDomains  []string `json:"excluded_dns_domains,omitempty" yaml:"excluded_dns_domains,omitempty"`
+	PermittedIPRanges   []string `json:"permitted_ip_ranges,omitempty" yaml:"permitted_ip_ranges,omitempty"`
+	ExcludedIPRanges    []string `json:"excluded_ip_ranges,omitempty" yaml:"excluded_ip_ranges,omitempty"`
+	PermittedEmails     []string `json:"permitted_emails,omitempty" yaml:"permitted_emails,omitempty"`
+	ExcludedEmails      []string `json:"excluded_emails,omitempty" yaml:"excluded_emails,omitempty"`
+	PermittedURIDomains []string `json:"permitted_uri_domains,omitempty" yaml:"permitted_uri_domains,omitempty"`
+	ExcludedURIDomains  []string `json:"excluded_uri_domains,omitempty" yaml:"excluded_uri_domains,omitempty"`
+}
+
+// OtherExtension is an extension that isn't decoded. Name is empty for
+// unknown OIDs.
+type OtherExtension struct {
+	OID      string `json:"oid" yaml:"oid"`
+	Name     string `json:"name,omitempty" yaml:"name,omitempty"`
+	Critical bool   `json:"critical" yaml:"critical"`
+	Value    string `json:"value" yaml:"value"`
+}
+
+var (
+	oidTLSFeature      = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+	oidNameConstraints = asn1.ObjectIdentifier{2, 5, 29, 30}
+)
+
+// decodedExtensions are the OIDs that have their own field in Extensions.
+var decodedExtensions = map[string]bool{
+	"2.5.29.14":          true, // subject key identifier
+	"2.5.29.15":          true, // key usage
+	"2.5.29.17":          true, // subject alternative name
+	"2.5.29.19":          true, // basic constraints
+	"2.5.29.30":          true, // name constraints
+	"2.5.29.31":          true, // CRL distribution points
+	"2.5.29.32":          true, // certificate policies
+	"2.5.29.35":          true, // authority key identifier
+	"2.5.29.37":          true, // extended key usage
+	"1.3.6.1.5.5.7.1.1":  true, // authority information access
+	"1.3.6.1.5.5.7.1.24": true, // TLS feature
+}
+
+var extensionNames = map[string]string{
+	"2.5.29.9":                "Subject Directory Attributes",
+	"2.5.29.16":               "Private Key Usage Period",
+	"2.5.29.18":               "Issuer Alternative Name",
+	"2.5.29.20":               "CRL Number",
+	"2.5.29.33":               "Policy Mappings",
+	"2.5.29.36":               "Policy Constraints",
+	"2.5.29.46":               "Freshest CRL",
+	"2.5.29.54":               "Inhibit Any Policy",
+	"1.3.6.1.5.5.7.1.3":       "QC Statements",
+	"1.3.6.1.5.5.7.1.11":      "Subject Information Access",
+	"1.3.6.1.5.5.7.48.1.5":    "OCSP No Check",
+	"1.3.6.1.4.1.11129.2.4.2": "CT Precertificate SCTs",
+	"1.3.6.1.4.1.11129.2.4.3": "CT Precertificate Poison",
+	"1.3.6.1.4.1.311.20.2":    "Microsoft Certificate Template Name",
+	"1.3.6.1.4.1.311.21.7":    "Microsoft Certificate Template",
+	"1.3.6.1.4.1.311.21.10":   "Microsoft Application Policies",
+	"2.16.840.1.113730.1.1":   "Netscape Certificate Type",
+	"2.16.840.1.113730.1.13":  "Netscape Comment",
+}
+
+var keyUsageNames = []string{
+	"digitalSignature",
+	"contentCommitment",
+	"keyEncipherment",
+	"dataEncipherment",
+	"keyAgreement",
+	"keyCertSign",
+	"cRLSign",
+	"encipherOnly",
+	"decipherOnly",
+}
+
+var extKeyUsageNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:                            "any",
+	x509.ExtKeyUsageServerAuth:                     "serverAuth",
+	x509.ExtKeyUsageClientAuth:                     "clientAuth",
+	x509.ExtKeyUsageCodeSigning:                    "codeSigning",
+	x509.ExtKeyUsageEmailProtection:                "emailProtection",
+	x509.ExtKeyUsageIPSECEndSystem:                 "ipsecEndSystem",
+	x509.ExtKeyUsageIPSECTunnel:                    "ipsecTunnel",
+	x509.ExtKeyUsageIPSECUser:                      "ipsecUser",
+	x509.ExtKeyUsageTimeStamping:                   "timeStamping",
+	x509.ExtKeyUsageOCSPSigning:                    "OCSPSigning",
+	x509.ExtKeyUsageMicrosoftServerGatedCrypto:     "msSGC",
+	x509.ExtKeyUsageNetscapeServerGatedCrypto:      "nsSGC",
+	x509.ExtKeyUsageMicrosoftCommercialCodeSigning: "msCodeCom",
+	x509.ExtKeyUsageMicrosoftKernelCodeSigning:     "msKernelCode",
+}
+
+var policyNames = map[string]string{
+	"2.5.29.32.0":    "anyPolicy",
+	"2.23.140.1.1":   "extended validation",
+	"2.23.140.1.2.1": "domain validated",
+	"2.23.140.1.2.2": "organization validated",
+	"2.23.140.1.2.3": "individual validated",
+}
+
+// DecodeExtensions decodes the extensions of a certificate.
+func DecodeExtensions(cert *x509.Certificate) Extensions {
+	ext := Extensions{
+		Subject:               cert.Subject.String(),
+		OCSPServers:           cert.OCSPServer,
+		IssuingCertificateURL: cert.IssuingCertificateURL,
+		CRLDistributionPoints: cert.CRLDistributionPoints,
+		SubjectKeyID:          hexID(cert.SubjectKeyId),
+		AuthorityKeyID:        hexID(cert.AuthorityKeyId),
+		DNSNames:              cert.DNSNames,
+		EmailAddresses:        cert.EmailAddresses,
+	}
+	for i, name := range keyUsageNames {
+		if cert.KeyUsage&(1<<i) != 0 {
+			ext.KeyUsage = append(ext.KeyUsage, name)
+		}
+	}
+	for _, usage := range cert.ExtKeyUsage {
+		ext.ExtKeyUsage = append(ext.ExtKeyUsage, extKeyUsageNames[usage])
+	}
+	for _, oid := range cert.UnknownExtKeyUsage {
+		ext.ExtKeyUsage = append(ext.ExtKeyUsage, oid.String())
+	}
+	if cert.BasicConstraintsValid {
+		ext.BasicConstraints = &BasicConstraints{CA: cert.IsCA}
+		if cert.MaxPathLen > 0 || cert.MaxPathLenZero {
+			maxPathLen := cert.MaxPathLen
+			ext.BasicConstraints.MaxPathLen = &maxPathLen
+		}
+	}
+	for _, policy := range cert.Policies {
+		oid := policy.String()
+		if name, ok := policyNames[oid]; ok {
+			oid += " (" + name + ")"
+		}
+		ext.Policies = append(ext.Policies, oid)
+	}
+	for _, ip := range cert.IPAddresses {
+		ext.IPAddresses = append(ext.IPAddresses, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		ext.URIs = append(ext.URIs, uri.String())
+	}
+
+	for _, extension := range cert.Extensions {
+		switch {
+		case extension.Id.Equal(oidNameConstraints):
+			ext.NameConstraints = newNameConstraints(cert, extension.Critical)
+		case extension.Id.Equal(oidTLSFeature):
+			ext.MustStaple = hasStatusRequest(extension.Value)
+		case !decodedExtensions[extension.Id.String()]:
+			ext.Other = append(ext.Other, OtherExtension{
+				OID:      extension.Id.String(),
+				Name:     extensionNames[extension.Id.String()],
+				Critical: extension.Critical,
+				Value:    hex.EncodeToString(extension.Value),
+			})
+		}
+	}
+	return ext
+}
+
+func newNameConstraints(cert *x509.Certificate, critical bool) *NameConstraints {
+	constraints := &NameConstraints{
+		Critical:            critical,
+		PermittedDNSDomains: cert.PermittedDNSDomains,
+		ExcludedDNSDomains:  cert.ExcludedDNSDomains,
+		PermittedEmails:     cert.PermittedEmailAddresses,
+		ExcludedEmails:      cert.ExcludedEmailAddresses,
+		PermittedURIDomains: cert.PermittedURIDomains,
+		ExcludedURIDomains:  cert.ExcludedURIDomains,
+	}
+	for _, ipRange := range cert.PermittedIPRanges {
+		constraints.PermittedIPRanges = append(constraints.PermittedIPRanges, ipRange.String())
+	}
+	for _, ipRange := range cert.ExcludedIPRanges {
+		constraints.ExcludedIPRanges = append(constraints.ExcludedIPRanges, ipRange.String())
+	}
+	return constraints
+}
+
+// hasStatusRequest reports whether a TLS feature extension (RFC 7633)
+// requires status_request, i.e. OCSP must-staple.
+func hasStatusRequest(value []byte) bool {
+	var features []int
+	if _, err := asn1.Unmarshal(value, &features); err != nil {
+		return false
+	}
+	for _, feature := range features {
+		// status_request
+		if feature == 5 {
+			return true
+		}
+	}
+	return false
+}
+
+// hexID formats a key identifier like openssl, e.g. 0A:1B:2C.
+func hexID(id []byte) string {
+	if len(id) == 0 {
+		return ""
+	}
+	parts := make([]string, len(id))
+	for i, b := range id {
+		parts[i] = strings.ToUpper(hex.EncodeToString([]byte{b}))
+	}
+	return strings.Join(parts, ":")
+}
@@ -0,0 +1,97 @@
+package details
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net"
+	"net/url"
+	"reflect"
+	"ssltool/pkg/internal/testcert"
+	"testing"
+)
+
+func TestDecodeExtensions(t *testing.T) {
+	root := testcert.NewCA(t, "Test Root", nil)
+	_, permitted, _ := net.ParseCIDR("10.0.0.0/8")
+	ca := testcert.CATemplate("Test Intermediate")
+	ca.MaxPathLenZero = true
+	ca.PermittedDNSDomains = []string{"example.com"}
+	ca.PermittedIPRanges = []*net.IPNet{permitted}
+	ca.PermittedDNSDomainsCritical = true
+	intermediate := testcert.Issue(t, ca, root)
+
+	mustStaple, _ := asn1.Marshal([]int{5})
+	spiffe, _ := url.Parse("spiffe://example.com/web")
+	template := testcert.LeafTemplate("www.example.com")
+	template.IPAddresses = []net.IP{net.ParseIP("10.0.0.5")}
+	template.EmailAddresses = []string{"admin@example.com"}
+	template.URIs = []*url.URL{spiffe}
+	template.OCSPServer = []string{"http://ocsp.example.com"}
+	template.IssuingCertificateURL = []string{"http://ca.example.com/intermediate.cer"}
+	template.CRLDistributionPoints = []string{"http://crl.example.com/intermediate.crl"}
+	template.PolicyIdentifiers = []asn1.ObjectIdentifier{{2, 23, 140, 1, 2, 1}}
+	template.SubjectKeyId = []byte{1, 2, 3}
+	template.ExtraExtensions = []pkix.Extension{
+		{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}, Value: mustStaple},
+		{Id: asn1.ObjectIdentifier{1, 2, 3, 4}, Critical: false, Value: []byte{0x05, 0x00}},
+	}
+	leaf := testcert.Issue(t, template, intermediate)
+
+	ext := DecodeExtensions(leaf.Cert)
+	if ext.Subject != "CN=www.example.com" {
+		t.Errorf("subject mismatch; got %q", ext.Subject)
+	}
+	if !reflect.DeepEqual(ext.KeyUsage, []string{"digitalSignature"}) {
+		t.Errorf("key usage mismatch; got %v", ext.KeyUsage)
+	}
+	if !reflect.DeepEqual(ext.ExtKeyUsage, []string{"serverAuth"}) {
+		t.Errorf("extended key usage mismatch; got %v", ext.ExtKeyUsage)
+	}
+	if ext.BasicConstraints != nil {
+		t.Errorf("expected no basic constraints on the leaf, got %+v", ext.BasicConstraints)
+	}
+	if !reflect.DeepEqual(ext.Policies, []string{"2.23.140.1.2.1 (domain validated)"}) {
+		t.Errorf("policies mismatch; got %v", ext.Policies)
+	}
+	if !reflect.DeepEqual(ext.IPAddresses, []string{"10.0.0.5"}) || !reflect.DeepEqual(ext.URIs, []string{"spiffe://example.com/web"}) ||
+		!reflect.DeepEqual(ext.EmailAddresses, []string{"admin@example.com"}) {
+		t.Errorf("SAN mismatch; got %v %v %v", ext.IPAddresses, ext.URIs, ext.EmailAddresses)
+	}
+	if len(ext.OCSPServers) != 1 || len(ext.IssuingCertificateURL) != 1 || len(ext.CRLDistributionPoints) != 1 {
+		t.Errorf("expected AIA and CRL URLs, got %+v", ext)
+	}
+	if ext.SubjectKeyID != "01:02:03" || ext.AuthorityKeyID != hexID(intermediate.Cert.SubjectKeyId) {
+		t.Errorf("key identifier mismatch; got %q and %q", ext.SubjectKeyID, ext.AuthorityKeyID)
+	}
+	if !ext.MustStaple {
+		t.Error("expected must-staple")
+	}
+	if len(ext.Other) != 1 || ext.Other[0].OID != "1.2.3.4" || ext.Other[0].Value != "0500" {
+		t.Errorf("expected the unknown extension, got %+v", ext.Other)
+	}
+
+	ext = DecodeExtensions(intermediate.Cert)
+	if ext.BasicConstraints == nil || !ext.BasicConstraints.CA || ext.BasicConstraints.MaxPathLen == nil || *ext.BasicConstraints.MaxPathLen != 0 {
+		t.Errorf("basic constraints mismatch; got %+v", ext.BasicConstraints)
+	}
+	if !reflect.DeepEqual(ext.KeyUsage, []string{"keyCertSign", "cRLSign"}) {
+		t.Errorf("key usage mismatch; got %v", ext.KeyUsage)
+	}
+	nc := ext.NameConstraints
+	if nc == nil || !nc.Critical || !reflect.DeepEqual(nc.PermittedDNSDomains, []string{"example.com"}) ||
+		!reflect.DeepEqual(nc.PermittedIPRanges, []string{"10.0.0.0/8"}) {
+		t.Errorf("name constraints mismatch; got %+v", nc)
+	}
+	if ext.MustStaple || len(ext.Other) != 0 {
+		t.Errorf("unexpected extensions: %+v", ext)
+	}
+}
+
+func TestHexID(t *testing.T) {
+	if got := hexID([]byte{0x0a, 0x1b, 0xff}); got != "0A:1B:FF" {
+		t.Errorf("unexpected id %q", got)
+	}
+	if hexID(nil) != "" {
+		t.Error("expected empty id")
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package details
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+)
+
+const (
+	WarningOutOfOrder    = "out of order"
+	WarningNotSigned     = "not signed by next"
+	WarningDuplicate     = "duplicate"
+	WarningRootIncluded  = "root included"
+	WarningUnrelated     = "unrelated certificate"
+	WarningKeyIDMismatch = "key identifier mismatch"
+)
+
+// ChainWarning is a problem with how the chain was served that may not
+// break verification in every client.
+type ChainWarning struct {
+	Check  string `json:"check" yaml:"check"`
+	Detail string `json:"detail" yaml:"detail"`
+}
+
+// LintChain checks that each served certificate (leaf first) is signed by
+// the next one, that nothing is sent twice or unnecessarily and that the
+// authority and subject key identifiers agree.
+func LintChain(served []*x509.Certificate) []ChainWarning {
+	var warnings []ChainWarning
+	warn := func(check, format string, args ...any) {
+		warnings = append(warnings, ChainWarning{Check: check, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	duplicate := make([]bool, len(served))
+	for i := range served {
+		for j := 0; j < i; j++ {
+			if !duplicate[j] && served[i].Equal(served[j]) {
+				duplicate[i] = true
+				warn(WarningDuplicate, "certificate %d (%s) is the same as certificate %d", i, served[i].Subject, j)
+				break
+			}
+		}
+	}
+
+	// signer[i] is the index of the served certificate that signed served[i]
+	signer := make([]int, len(served))
+	used := make([]bool, len(served))
+	for i, cert := range served {
+		signer[i] = -1
+		if duplicate[i] || isSelfSigned(cert) {
+			continue
+		}
+		if i+1 < len(served) && cert.CheckSignatureFrom(served[i+1]) == nil {
+			signer[i] = i + 1
+		} else {
+			for j, candidate := range served {
+				if j != i && !duplicate[j] && cert.CheckSignatureFrom(candidate) == nil {
+					signer[i] = j
+					break
+				}
+			}
+		}
+		if signer[i] >= 0 {
+			used[signer[i]] = true
+		}
+		switch {
+		case signer[i] >= 0 && signer[i] != i+1:
+			warn(WarningOutOfOrder, "certificate %d (%s) is signed by certificate %d, not the one after it", i, cert.Subject, signer[i])
+		case signer[i] < 0 && i+1 < len(served) && !duplicate[i+1]:
+			warn(WarningNotSigned, "certificate %d (%s) is not signed by certificate %d (%s)", i, cert.Subject, i+1, served[i+1].Subject)
+		}
+	}
+
+	for i, cert := range served {
+		if i == 0 || duplicate[i] {
+			continue
+		}
+		if isSelfSigned(cert) {
+			warn(WarningRootIncluded, "self-signed root %s is sent; clients must already trust it", cert.Subject)
+		} else if !used[i] {
+			warn(WarningUnrelated, "certificate %d (%s) did not sign any served certificate", i, cert.Subject)
+		}
+	}
+
+	for i, cert := range served {
+		if signer[i] < 0 {
+			continue
+		}
+		issuer := served[signer[i]]
+		if len(cert.AuthorityKeyId) > 0 && len(issuer.SubjectKeyId) > 0 && !bytes.Equal(cert.AuthorityKeyId, issuer.SubjectKeyId) {
+			warn(WarningKeyIDMismatch, "authority key identifier %x of %s does not match subject key identifier %x of %s",
+				cert.AuthorityKeyId, cert.Subject, issuer.SubjectKeyId, issuer.Subject)
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,44 @@
+package details
+
+import (
+	"crypto/x509"
+	"ssltool/pkg/internal/testcert"
+	"testing"
+)
+
+func TestLintChain(t *testing.T) {
+	root, intermediate, leaf := testcert.NewChain(t)
+	other := testcert.NewCA(t, "Other Intermediate", root)
+
+	// sign a leaf with the intermediate's key but a different key identifier
+	wrongID := *intermediate.Cert
+	wrongID.SubjectKeyId = []byte{1, 2, 3, 4}
+	mismatched := testcert.Issue(t, testcert.LeafTemplate("www.example.com"), &testcert.Cert{Cert: &wrongID, Key: intermediate.Key})
+
+	tests := []struct {
+		name   string
+		served []*x509.Certificate
+		want   []string
+	}{
+		{"ordered", []*x509.Certificate{leaf.Cert, intermediate.Cert}, nil},
+		{"leaf only", []*x509.Certificate{leaf.Cert}, nil},
+		{"root included", []*x509.Certificate{leaf.Cert, intermediate.Cert, root.Cert}, []string{WarningRootIncluded}},
+		{"out of order", []*x509.Certificate{leaf.Cert, other.Cert, intermediate.Cert}, []string{WarningOutOfOrder, WarningNotSigned, WarningUnrelated}},
+		{"duplicate", []*x509.Certificate{leaf.Cert, intermediate.Cert, intermediate.Cert}, []string{WarningDuplicate}},
+		{"wrong intermediate", []*x509.Certificate{leaf.Cert, other.Cert}, []string{WarningNotSigned, WarningUnrelated}},
+		{"key identifier mismatch", []*x509.Certificate{mismatched.Cert, intermediate.Cert}, []string{WarningKeyIDMismatch}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings := LintChain(tt.served)
+			if len(warnings) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, warnings)
+			}
+			for i, check := range tt.want {
+				if warnings[i].Check != check {
+					t.Errorf("warning %d mismatch; got %q, want %q", i, warnings[i].Check, check)
+				}
+			}
+		})
+	}
+}
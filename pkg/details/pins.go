@@ -0,0 +1,51 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package details
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// SPKIPin returns the base64 SHA-256 hash of the certificate's
+// SubjectPublicKeyInfo, the pin-sha256 value of HPKP.
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// NormalizePin accepts a pin as plain base64, "sha256/<base64>" (OkHttp,
+// TrustKit) or `pin-sha256="<base64>"` (HPKP) and returns the base64 value.
+func NormalizePin(pin string) (string, error) {
+	value := strings.TrimSpace(pin)
+	value = strings.TrimPrefix(value, "sha256/")
+	if strings.HasPrefix(value, "pin-sha256=") {
+		value = strings.Trim(strings.TrimPrefix(value, "pin-sha256="), `"`)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(decoded) != sha256.Size {
+		return "", fmt.Errorf("invalid SHA-256 pin %q", pin)
+	}
+	return value, nil
+}
+
+// MatchPins returns the first certificate in chain whose SPKI pin is one of
+// pins, which must already be normalized.
+func MatchPins(chain []CertDetails, pins []string) (CertDetails, bool) {
+	for _, certDetails := range chain {
+		pin := certDetails.SPKIPin
+		if pin == "" {
+			pin = SPKIPin(certDetails.Cert)
+		}
+		for _, expected := range pins {
+			if pin == expected {
+				return certDetails, true
+			}
+		}
+	}
+	return CertDetails{}, false
+}
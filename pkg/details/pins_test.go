@@ -0,0 +1,79 @@
+package details
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"ssltool/pkg/internal/testcert"
+	"testing"
+)
+
+// pinTestCert's pin and fingerprint were computed with openssl:
+//
+//	openssl x509 -pubkey -noout | openssl pkey -pubin -outform der | openssl dgst -sha256 -binary | base64
+const pinTestCert = `-----BEGIN CERTIFICATE-----
+MIIBvTCCAWKgAwIBAgIURrPNObVL75bDbhwbu4HNVwb5jVkwCgYIKoZIzj0EAwIw
+ETEPMA0GA1UEAwwGQUlBSW50MB4XDTI2MTAxNzA0MTcyOFoXDTI2MTAxOTA0MTcy
+OFowFDESMBAGA1UEAwwJbG9jYWxob3N0MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcD
+QgAEDOrfVEdxsON2zyp9Xv9TPC+Dk3vpNTU9VuaZEbR/I6uSuYfL6uOXMujGTPVQ
+wEXulhUZw4x/sYDrpHn4DJwWMqOBlDCBkTAUBgNVHREEDTALgglsb2NhbGhvc3Qw
+OQYIKwYBBQUHAQEELTArMCkGCCsGAQUFBzAChh1odHRwOi8vMTI3LjAuMC4xOjg3
+ODAvaW50LmNlcjAdBgNVHQ4EFgQURPq3CN88RY/Suc3gIY8T1SA5tUEwHwYDVR0j
+BBgwFoAUMzYkkVMVeIdx4NiXRIyuUXCMSlkwCgYIKoZIzj0EAwIDSQAwRgIhALBP
+gwqnM9g766a+8cEKDy8ictaDUA1An9WU2/h5KecbAiEA9Y02Yl1B/3BgbPywTqrt
+5TVsSZV6Z9bJbcsuR2P1ZhY=
+-----END CERTIFICATE-----
+`
+
+const (
+	pinTestPin    = "6z2xH7BFFjYcfil9f8E4JxexxUFCmdF5HTz2QsDcd6I="
+	pinTestSHA256 = "0b82c4df051d968adfdf92b3f59d6827e2a437e45703481845a0b442651586d3"
+)
+
+func TestNewCertDetails_Fingerprints(t *testing.T) {
+	block, _ := pem.Decode([]byte(pinTestCert))
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	certDetails := NewCertDetails(cert)
+	if certDetails.SPKIPin != pinTestPin {
+		t.Errorf("pin mismatch; got %s, want %s", certDetails.SPKIPin, pinTestPin)
+	}
+	if certDetails.SHA256Fingerprint != pinTestSHA256 {
+		t.Errorf("fingerprint mismatch; got %s, want %s", certDetails.SHA256Fingerprint, pinTestSHA256)
+	}
+	if len(certDetails.SHA1Fingerprint) != 40 {
+		t.Errorf("unexpected SHA-1 fingerprint %q", certDetails.SHA1Fingerprint)
+	}
+}
+
+func TestNormalizePin(t *testing.T) {
+	for _, pin := range []string{
+		pinTestPin,
+		"sha256/" + pinTestPin,
+		`pin-sha256="` + pinTestPin + `"`,
+	} {
+		got, err := NormalizePin(pin)
+		if err != nil || got != pinTestPin {
+			t.Errorf("NormalizePin(%q) = %q, %v", pin, got, err)
+		}
+	}
+	for _, pin := range []string{"", "not base64!", "c2hvcnQ="} {
+		if _, err := NormalizePin(pin); err == nil {
+			t.Errorf("expected an error for %q", pin)
+		}
+	}
+}
+
+func TestMatchPins(t *testing.T) {
+	root, intermediate, leaf := testcert.NewChain(t)
+	chain := []CertDetails{NewCertDetails(root.Cert), NewCertDetails(intermediate.Cert), NewCertDetails(leaf.Cert)}
+
+	matched, ok := MatchPins(chain, []string{pinTestPin, SPKIPin(intermediate.Cert)})
+	if !ok || matched.Cert != intermediate.Cert {
+		t.Errorf("expected the intermediate to match, got %v", ok)
+	}
+	if _, ok := MatchPins(chain, []string{pinTestPin}); ok {
+		t.Error("expected no match")
+	}
+}
@@ -0,0 +1,47 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package details
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+)
+
+var oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      asn1.RawValue
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      asn1.RawValue
+}
+
+// ParsePKCS7Certificates returns the certificates in a DER encoded PKCS#7
+// SignedData, such as a .p7b/.p7c bundle. Signatures are not checked.
+func ParsePKCS7Certificates(der []byte) ([]*x509.Certificate, error) {
+	var info contentInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("invalid PKCS#7: %w", err)
+	}
+	if !info.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("unsupported PKCS#7 content type %s", info.ContentType)
+	}
+	var data signedData
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &data); err != nil {
+		return nil, fmt.Errorf("invalid PKCS#7 signed data: %w", err)
+	}
+	if len(data.Certificates.Bytes) == 0 {
+		return nil, errors.New("PKCS#7 contains no certificates")
+	}
+	return x509.ParseCertificates(data.Certificates.Bytes)
+}
@@ -0,0 +1,175 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package details
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/pem"
+	"fmt"
+	"time"
+)
+
+// SchemaVersion is the version of the Report schema. It is only incremented
+// when a field is renamed, removed or changes meaning; new fields may be
+// added without a version change.
+const SchemaVersion = 1
+
+// Report is the machine-readable form of a certificate chain.
+type Report struct {
+	SchemaVersion int                 `json:"schema_version" yaml:"schema_version"`
+	Host          string              `json:"host,omitempty" yaml:"host,omitempty"`
+	Certificates  []CertificateReport `json:"certificates" yaml:"certificates"`
+	Verification  *Verification       `json:"verification,omitempty" yaml:"verification,omitempty"`
+	Lint          []ChainWarning      `json:"lint,omitempty" yaml:"lint,omitempty"`
+	ClientAuth    *ClientAuth         `json:"client_auth,omitempty" yaml:"client_auth,omitempty"`
+	Connection    *Connection         `json:"connection,omitempty" yaml:"connection,omitempty"`
+	Completion    *CompletionReport   `json:"completion,omitempty" yaml:"completion,omitempty"`
+}
+
+type CertificateReport struct {
+	Subject            string       `json:"subject" yaml:"subject"`
+	Issuer             string       `json:"issuer" yaml:"issuer"`
+	Serial             string       `json:"serial" yaml:"serial"`
+	NotBefore          time.Time    `json:"not_before" yaml:"not_before"`
+	NotAfter           time.Time    `json:"not_after" yaml:"not_after"`
+	DNSNames           []string     `json:"dns_names" yaml:"dns_names"`
+	KeyAlgorithm       string       `json:"key_algorithm" yaml:"key_algorithm"`
+	SignatureAlgorithm string       `json:"signature_algorithm" yaml:"signature_algorithm"`
+	Fingerprints       Fingerprints `json:"fingerprints" yaml:"fingerprints"`
+	Extensions         Extensions   `json:"extensions" yaml:"extensions"`
+	PEM                string       `json:"pem" yaml:"pem"`
+}
+
+// CompletionReport describes the issuers fetched to complete the chain.
+type CompletionReport struct {
+	Fetched      []FetchedReport `json:"fetched" yaml:"fetched"`
+	Verification Verification    `json:"verification" yaml:"verification"`
+	FullChainPEM string          `json:"fullchain_pem" yaml:"fullchain_pem"`
+	Error        string          `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+type FetchedReport struct {
+	CertificateReport `yaml:",inline"`
+	URL               string `json:"url" yaml:"url"`
+}
+
+type Fingerprints struct {
+	SHA1   string `json:"sha1" yaml:"sha1"`
+	SHA256 string `json:"sha256" yaml:"sha256"`
+	// SPKISHA256 is the base64 SPKI pin.
+	SPKISHA256 string `json:"spki_sha256" yaml:"spki_sha256"`
+}
+
+// NewReport builds a Report from a chain returned by RetrieveCertDetails.
+func NewReport(host string, chain []CertDetails) Report {
+	report := Report{
+		SchemaVersion: SchemaVersion,
+		Host:          host,
+		Certificates:  make([]CertificateReport, 0, len(chain)),
+	}
+	for _, certDetails := range chain {
+		report.Certificates = append(report.Certificates, newCertificateReport(certDetails))
+	}
+	return report
+}
+
+func newCertificateReport(certDetails CertDetails) CertificateReport {
+	cert := certDetails.Cert
+	dnsNames := certDetails.DNSNames
+	if dnsNames == nil {
+		dnsNames = []string{}
+	}
+	// CertDetails built by hand rather than with NewCertDetails lack the hashes
+	if certDetails.SHA256Fingerprint == "" {
+		certDetails = NewCertDetails(cert)
+	}
+	return CertificateReport{
+		Subject:            cert.Subject.String(),
+		Issuer:             certDetails.Issuer,
+		Serial:             fmt.Sprintf("%x", cert.SerialNumber),
+		NotBefore:          cert.NotBefore.UTC(),
+		NotAfter:           certDetails.NotAfter.UTC(),
+		DNSNames:           dnsNames,
+		KeyAlgorithm:       KeyAlgorithm(certDetails),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		Fingerprints: Fingerprints{
+			SHA1:       certDetails.SHA1Fingerprint,
+			SHA256:     certDetails.SHA256Fingerprint,
+			SPKISHA256: certDetails.SPKIPin,
+		},
+		Extensions: DecodeExtensions(cert),
+		PEM:        string(encodePem(certDetails)),
+	}
+}
+
+// NewResultReport is like NewReport but also includes the verification result.
+func NewResultReport(host string, result Result) Report {
+	report := NewReport(host, result.Chain)
+	verification := result.Verification
+	report.Verification = &verification
+	report.Lint = result.Lint
+	connection := result.Connection
+	report.Connection = &connection
+	if result.ClientAuth.Requested {
+		clientAuth := result.ClientAuth
+		report.ClientAuth = &clientAuth
+	}
+	if result.Completion != nil {
+		completion := CompletionReport{
+			Fetched:      make([]FetchedReport, 0, len(result.Completion.Fetched)),
+			Verification: result.Completion.Verification,
+			FullChainPEM: string(FullChainPEM(result.Completion.Chain)),
+		}
+		for _, issuer := range result.Completion.Fetched {
+			completion.Fetched = append(completion.Fetched, FetchedReport{
+				CertificateReport: newCertificateReport(NewCertDetails(issuer.Cert)),
+				URL:               issuer.URL,
+			})
+		}
+		if result.Completion.Err != nil {
+			completion.Error = result.Completion.Err.Error()
+		}
+		report.Completion = &completion
+	}
+	return report
+}
+
+// KeyAlgorithm describes the certificate's public key, e.g. RSA-2048 or ECDSA-P-256.
+func KeyAlgorithm(details CertDetails) string {
+	if algorithm := PublicKeyAlgorithm(details.Cert.PublicKey); algorithm != "" {
+		return algorithm
+	}
+	return details.Cert.PublicKeyAlgorithm.String()
+}
+
+// PublicKeyAlgorithm is like KeyAlgorithm for any public key. It returns an
+// empty string for unsupported key types.
+func PublicKeyAlgorithm(publicKey crypto.PublicKey) string {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA-%d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("ECDSA-%s", key.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return "Ed25519"
+	case *ecdh.PublicKey:
+		if key.Curve() == ecdh.X25519() {
+			return "X25519"
+		}
+		return fmt.Sprintf("ECDH-%s", key.Curve())
+	default:
+		return ""
+	}
+}
+
+func encodePem(details CertDetails) []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: details.Cert.Raw,
+	})
+}
@@ -0,0 +1,89 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package details
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// LoadRoots builds the trust store for verification from PEM bundles and
+// directories of PEM certificates (such as a c_rehash directory), on top
+// of the system roots unless noSystemRoots is set. It returns nil, meaning
+// the system roots, when nothing is configured.
+func LoadRoots(caFiles, caDirs []string, noSystemRoots bool) (*x509.CertPool, error) {
+	if len(caFiles) == 0 && len(caDirs) == 0 && !noSystemRoots {
+		return nil, nil
+	}
+	var pool *x509.CertPool
+	if noSystemRoots {
+		pool = x509.NewCertPool()
+	} else {
+		systemPool, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load system roots: %w", err)
+		}
+		pool = systemPool
+	}
+
+	loaded := 0
+	for _, caFile := range caFiles {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		n := appendPemCerts(pool, data)
+		if n == 0 {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		loaded += n
+	}
+	for _, caDir := range caDirs {
+		entries, err := os.ReadDir(caDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			// os.ReadFile follows the symlinks c_rehash creates.
+			data, err := os.ReadFile(filepath.Join(caDir, entry.Name()))
+			if err != nil {
+				continue
+			}
+			loaded += appendPemCerts(pool, data)
+		}
+	}
+	if noSystemRoots && loaded == 0 {
+		return nil, errors.New("no trusted roots: --no-system-roots requires --ca-file or --ca-dir")
+	}
+	return pool, nil
+}
+
+// appendPemCerts adds every parseable certificate in data and returns how
+// many were added.
+func appendPemCerts(pool *x509.CertPool, data []byte) int {
+	n := 0
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return n
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		pool.AddCert(cert)
+		n++
+	}
+}
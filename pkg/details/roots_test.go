@@ -0,0 +1,85 @@
+package details
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"ssltool/pkg/internal/testcert"
+	"testing"
+	"time"
+)
+
+func writePemCerts(t *testing.T, path string, certs ...*x509.Certificate) {
+	t.Helper()
+	var data []byte
+	for _, cert := range certs {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func TestLoadRoots_Default(t *testing.T) {
+	pool, err := LoadRoots(nil, nil, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pool != nil {
+		t.Error("expected nil pool to select the system roots")
+	}
+}
+
+func TestLoadRoots_CAFile(t *testing.T) {
+	root, intermediate, leaf := testcert.NewChain(t)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writePemCerts(t, caFile, root.Cert)
+
+	pool, err := LoadRoots([]string{caFile}, nil, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	v := Verify([]*x509.Certificate{leaf.Cert, intermediate.Cert}, "www.example.com", pool, time.Now())
+	if !v.Trusted {
+		t.Errorf("expected chain to be trusted by the CA file, got %v", v.Problems)
+	}
+}
+
+func TestLoadRoots_CADir(t *testing.T) {
+	root, intermediate, leaf := testcert.NewChain(t)
+	dir := t.TempDir()
+	writePemCerts(t, filepath.Join(dir, "root.pem"), root.Cert)
+	// c_rehash style symlink and an unrelated file
+	if err := os.Symlink("root.pem", filepath.Join(dir, "1a2b3c4d.0")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("not a certificate"), 0600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	pool, err := LoadRoots(nil, []string{dir}, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	v := Verify([]*x509.Certificate{leaf.Cert, intermediate.Cert}, "www.example.com", pool, time.Now())
+	if !v.Trusted {
+		t.Errorf("expected chain to be trusted by the CA dir, got %v", v.Problems)
+	}
+}
+
+func TestLoadRoots_Errors(t *testing.T) {
+	if _, err := LoadRoots(nil, nil, true); err == nil {
+		t.Error("expected error with no system roots and no CA files")
+	}
+	notCerts := filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(notCerts, []byte("nothing here"), 0600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if _, err := LoadRoots([]string{notCerts}, nil, false); err == nil {
+		t.Error("expected error for a CA file without certificates")
+	}
+	if _, err := LoadRoots([]string{filepath.Join(t.TempDir(), "missing.pem")}, nil, false); err == nil {
+		t.Error("expected error for a missing CA file")
+	}
+}
@@ -0,0 +1,175 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package details
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	ReasonUnknownAuthority = "unknown authority"
+	ReasonHostnameMismatch = "hostname mismatch"
+	ReasonExpired          = "expired"
+	ReasonNotYetValid      = "not yet valid"
+	ReasonInvalid          = "invalid"
+)
+
+type Verification struct {
+	Trusted  bool      `json:"trusted" yaml:"trusted"`
+	Problems []Problem `json:"problems,omitempty" yaml:"problems,omitempty"`
+	// MissingIssuer is the issuer of the topmost served certificate when
+	// nothing served or trusted signed it, usually a missing intermediate.
+	MissingIssuer string `json:"missing_issuer,omitempty" yaml:"missing_issuer,omitempty"`
+	// Chains holds the subjects of each verified chain, leaf first.
+	Chains [][]string `json:"chains,omitempty" yaml:"chains,omitempty"`
+	// VerifiedChain is the first verified chain, leaf first and ending
+	// with the trusted root.
+	VerifiedChain []*x509.Certificate `json:"-" yaml:"-"`
+	// Err is the first verification error.
+	Err error `json:"-" yaml:"-"`
+}
+
+type Problem struct {
+	Reason string `json:"reason" yaml:"reason"`
+	Detail string `json:"detail" yaml:"detail"`
+}
+
+func (v Verification) String() string {
+	if v.Trusted {
+		return "trusted"
+	}
+	s := "untrusted"
+	for i, problem := range v.Problems {
+		if i == 0 {
+			s += ": " + problem.Reason
+		} else {
+			s += ", " + problem.Reason
+		}
+	}
+	return s
+}
+
+// Verify checks the chain as served (leaf first) against roots, or the
+// system roots when roots is nil. Unlike x509.Certificate.Verify, which
+// stops at the first failure, it reports validity, hostname and chain
+// problems independently.
+func Verify(served []*x509.Certificate, serverName string, roots *x509.CertPool, now time.Time) Verification {
+	var v Verification
+	if len(served) == 0 {
+		v.addProblem(ReasonInvalid, errors.New("server sent no certificates"))
+		return v
+	}
+	leaf := served[0]
+
+	for _, cert := range served {
+		if now.After(cert.NotAfter) {
+			v.addProblem(ReasonExpired, fmt.Errorf("%s expired at %s", cert.Subject, cert.NotAfter.Format(time.RFC3339)))
+		} else if now.Before(cert.NotBefore) {
+			v.addProblem(ReasonNotYetValid, fmt.Errorf("%s is not valid until %s", cert.Subject, cert.NotBefore.Format(time.RFC3339)))
+		}
+	}
+
+	if serverName != "" {
+		if err := leaf.VerifyHostname(serverName); err != nil {
+			v.addProblem(ReasonHostnameMismatch, err)
+		}
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range served[1:] {
+		intermediates.AddCert(cert)
+	}
+	// Validity was checked above, so build the chain at a time the leaf is
+	// valid to still learn whether it chains to a trusted root.
+	chainTime := now
+	if now.After(leaf.NotAfter) {
+		chainTime = leaf.NotAfter
+	} else if now.Before(leaf.NotBefore) {
+		chainTime = leaf.NotBefore
+	}
+	chains, err := leaf.Verify(x509.VerifyOptions{
+		Intermediates: intermediates,
+		Roots:         roots,
+		CurrentTime:   chainTime,
+	})
+	if err != nil {
+		var unknownAuthority x509.UnknownAuthorityError
+		var invalid x509.CertificateInvalidError
+		switch {
+		case errors.As(err, &unknownAuthority):
+			top := topOfChain(served)
+			if isSelfSigned(top) {
+				v.addProblem(ReasonUnknownAuthority, fmt.Errorf("self-signed certificate %s is not trusted", top.Subject))
+			} else {
+				v.MissingIssuer = top.Issuer.String()
+				v.addProblem(ReasonUnknownAuthority, fmt.Errorf("issuer %s of %s was not served and is not trusted", top.Issuer, top.Subject))
+			}
+		case errors.As(err, &invalid) && invalid.Reason == x509.Expired:
+			// an intermediate that expired was already reported above
+			if !v.hasProblem(ReasonExpired) && !v.hasProblem(ReasonNotYetValid) {
+				v.addProblem(ReasonExpired, err)
+			}
+		default:
+			v.addProblem(ReasonInvalid, err)
+		}
+	}
+	if len(chains) > 0 {
+		v.VerifiedChain = chains[0]
+	}
+	for _, chain := range chains {
+		subjects := make([]string, len(chain))
+		for i, cert := range chain {
+			subjects[i] = cert.Subject.String()
+		}
+		v.Chains = append(v.Chains, subjects)
+	}
+	v.Trusted = len(v.Problems) == 0
+	return v
+}
+
+func (v *Verification) addProblem(reason string, err error) {
+	if v.Err == nil {
+		v.Err = err
+	}
+	v.Problems = append(v.Problems, Problem{Reason: reason, Detail: err.Error()})
+}
+
+func (v *Verification) hasProblem(reason string) bool {
+	for _, problem := range v.Problems {
+		if problem.Reason == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// topOfChain follows issuer signatures from the leaf through the served
+// certificates and returns the last certificate reached.
+func topOfChain(served []*x509.Certificate) *x509.Certificate {
+	current := served[0]
+	visited := map[*x509.Certificate]bool{current: true}
+	for {
+		var next *x509.Certificate
+		for _, candidate := range served {
+			if !visited[candidate] && current.CheckSignatureFrom(candidate) == nil {
+				next = candidate
+				break
+			}
+		}
+		if next == nil {
+			return current
+		}
+		visited[next] = true
+		current = next
+	}
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawSubject, cert.RawIssuer) &&
+		cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
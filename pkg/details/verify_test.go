@@ -0,0 +1,106 @@
+package details
+
+import (
+	"crypto/x509"
+	"ssltool/pkg/internal/testcert"
+	"testing"
+	"time"
+)
+
+func TestVerify_MissingIntermediate(t *testing.T) {
+	_, intermediate, leaf := testcert.NewChain(t)
+	v := Verify([]*x509.Certificate{leaf.Cert}, "www.example.com", nil, time.Now())
+	if v.Trusted {
+		t.Fatal("expected untrusted chain")
+	}
+	if !v.hasProblem(ReasonUnknownAuthority) {
+		t.Errorf("expected %q, got %v", ReasonUnknownAuthority, v.Problems)
+	}
+	if v.MissingIssuer != intermediate.Cert.Subject.String() {
+		t.Errorf("missing issuer mismatch; got %q, want %q", v.MissingIssuer, intermediate.Cert.Subject.String())
+	}
+	if v.Err == nil {
+		t.Error("expected Err to be set")
+	}
+}
+
+func TestVerify_UntrustedRoot(t *testing.T) {
+	root, intermediate, leaf := testcert.NewChain(t)
+	v := Verify([]*x509.Certificate{leaf.Cert, intermediate.Cert, root.Cert}, "www.example.com", nil, time.Now())
+	if !v.hasProblem(ReasonUnknownAuthority) {
+		t.Errorf("expected %q, got %v", ReasonUnknownAuthority, v.Problems)
+	}
+	if v.MissingIssuer != "" {
+		t.Errorf("expected no missing issuer when the root was served, got %q", v.MissingIssuer)
+	}
+}
+
+func TestVerify_MultipleProblems(t *testing.T) {
+	root := testcert.NewCA(t, "Test Root", nil)
+	expired := testcert.LeafTemplate("www.example.com")
+	expired.NotBefore = time.Now().Add(-48 * time.Hour)
+	expired.NotAfter = time.Now().Add(-24 * time.Hour)
+	leaf := testcert.Issue(t, expired, root)
+
+	v := Verify([]*x509.Certificate{leaf.Cert}, "other.example.com", nil, time.Now())
+	for _, reason := range []string{ReasonExpired, ReasonHostnameMismatch, ReasonUnknownAuthority} {
+		if !v.hasProblem(reason) {
+			t.Errorf("expected %q in %v", reason, v.Problems)
+		}
+	}
+	if v.String() != "untrusted: expired, hostname mismatch, unknown authority" {
+		t.Errorf("unexpected summary %q", v.String())
+	}
+}
+
+func TestVerify_NoCertificates(t *testing.T) {
+	v := Verify(nil, "www.example.com", nil, time.Now())
+	if v.Trusted || !v.hasProblem(ReasonInvalid) {
+		t.Errorf("expected invalid result, got %+v", v)
+	}
+}
+
+func TestVerify_CustomRoots(t *testing.T) {
+	root, intermediate, leaf := testcert.NewChain(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Cert)
+
+	v := Verify([]*x509.Certificate{leaf.Cert, intermediate.Cert}, "www.example.com", roots, time.Now())
+	if !v.Trusted {
+		t.Fatalf("expected trusted chain, got %v", v.Problems)
+	}
+	if len(v.Chains) != 1 || len(v.Chains[0]) != 3 {
+		t.Fatalf("expected one chain of three certificates, got %v", v.Chains)
+	}
+	if v.Chains[0][2] != root.Cert.Subject.String() {
+		t.Errorf("chain should end at the custom root, got %v", v.Chains[0])
+	}
+	if len(v.VerifiedChain) != 3 || v.VerifiedChain[2] != root.Cert {
+		t.Errorf("verified chain should end at the custom root, got %d certificates", len(v.VerifiedChain))
+	}
+
+	// the intermediate is still missing when only the leaf is served
+	v = Verify([]*x509.Certificate{leaf.Cert}, "www.example.com", roots, time.Now())
+	if v.Trusted || v.MissingIssuer != intermediate.Cert.Subject.String() {
+		t.Errorf("expected missing intermediate, got %+v", v)
+	}
+}
+
+func TestResult_RevocationChain(t *testing.T) {
+	root, intermediate, leaf := testcert.NewChain(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Cert)
+	served := []*x509.Certificate{leaf.Cert, intermediate.Cert}
+	result := Result{Chain: []CertDetails{{Cert: intermediate.Cert}, {Cert: leaf.Cert}}}
+
+	// the root is only known from the trust store
+	result.Verification = Verify(served, "www.example.com", roots, time.Now())
+	if chain := result.RevocationChain(); len(chain) != 3 || chain[0] != leaf.Cert || chain[2] != root.Cert {
+		t.Errorf("expected the verified chain with the root, got %d certificates", len(chain))
+	}
+
+	result.Verification = Verify(served, "www.example.com", nil, time.Now())
+	if chain := result.RevocationChain(); len(chain) != 2 || chain[0] != leaf.Cert {
+		t.Errorf("expected the served chain, got %d certificates", len(chain))
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -15,31 +16,72 @@ import (
 	"errors"
 	"fmt"
 	"io"
+
+	"github.com/youmark/pkcs8"
+)
+
+const (
+	KDFPBKDF2 = "pbkdf2"
+	KDFScrypt = "scrypt"
+)
+
+const (
+	KeyTypeRSA     = "rsa"
+	KeyTypeECDSA   = "ecdsa"
+	KeyTypeEd25519 = "ed25519"
+)
+
+// Private key encodings. The default picks PKCS#1 for RSA, SEC1 for ECDSA
+// and PKCS#8 for Ed25519. KeyFormatDER is binary PKCS#8.
+const (
+	KeyFormatPKCS1 = "pkcs1"
+	KeyFormatSEC1  = "sec1"
+	KeyFormatPKCS8 = "pkcs8"
+	KeyFormatDER   = "der"
 )
 
 type CsrInputInfo struct {
 	CommonName string
-	Sans       []string
+	// Sans are DNS names, IP addresses, email addresses or URIs, optionally
+	// tagged with their type. See ParseSANs.
+	Sans []string
 	pkix.Name
 	PrivKey crypto.PrivateKey
+	// Passphrase, if set, encrypts the private key as PKCS#8 with PBES2 and
+	// AES-256-CBC. KDF is KDFPBKDF2 (the default) or KDFScrypt.
+	Passphrase []byte
+	KDF        string
+	// KeyFormat is one of the KeyFormat constants, or empty for the default
+	// encoding of the key type.
+	KeyFormat string
 }
 
 type CsrOutputInfo struct {
 	CsrPem, PrivateKeyPem string
+	// PrivateKeyDer is set instead of PrivateKeyPem for KeyFormatDER.
+	PrivateKeyDer []byte
+	// Encrypted is set when the private key is an encrypted PKCS#8 key.
+	Encrypted bool
 }
 
 func NewCsr(source io.Reader, csrInfo CsrInputInfo) (CsrOutputInfo, error) {
 	if csrInfo.CommonName == "" && len(csrInfo.Sans) == 0 {
 		return CsrOutputInfo{}, errors.New("at least one of CommonName or SANs must be provided")
 	}
-	// Adding the CommonName to the Sans
 	if csrInfo.CommonName != "" {
 		csrInfo.Name.CommonName = csrInfo.CommonName
 	}
+	sans, err := ParseSANs(csrInfo.Sans)
+	if err != nil {
+		return CsrOutputInfo{}, err
+	}
 
 	cr := x509.CertificateRequest{
-		Subject:  csrInfo.Name,
-		DNSNames: csrInfo.Sans,
+		Subject:        csrInfo.Name,
+		DNSNames:       sans.DNSNames,
+		IPAddresses:    sans.IPAddresses,
+		EmailAddresses: sans.EmailAddresses,
+		URIs:           sans.URIs,
 	}
 	request, err := x509.CreateCertificateRequest(source, &cr, csrInfo.PrivKey)
 	if err != nil {
@@ -50,36 +92,157 @@ func NewCsr(source io.Reader, csrInfo CsrInputInfo) (CsrOutputInfo, error) {
 		Bytes: request,
 	})
 
-	var privKeyBytes []byte
-	var pemType string
-	switch key := csrInfo.PrivKey.(type) {
-	case *rsa.PrivateKey:
-		privKeyBytes = x509.MarshalPKCS1PrivateKey(key)
-		pemType = "RSA PRIVATE KEY"
-	case *ecdsa.PrivateKey:
-		privKeyBytes, err = x509.MarshalECPrivateKey(key)
-		if err != nil {
-			return CsrOutputInfo{}, fmt.Errorf("failed to marshal EC private key: %w", err)
+	keyPem, keyDer, err := encodePrivateKey(csrInfo)
+	if err != nil {
+		return CsrOutputInfo{}, err
+	}
+	return CsrOutputInfo{
+		CsrPem:        string(csrPem),
+		PrivateKeyPem: keyPem,
+		PrivateKeyDer: keyDer,
+		Encrypted:     len(csrInfo.Passphrase) > 0,
+	}, nil
+}
+
+// encodePrivateKey encodes csrInfo.PrivKey in its KeyFormat, encrypted if
+// a passphrase is set. Only one of the PEM and DER forms is returned.
+func encodePrivateKey(csrInfo CsrInputInfo) (string, []byte, error) {
+	if len(csrInfo.Passphrase) > 0 {
+		switch csrInfo.KeyFormat {
+		case "", KeyFormatPKCS8, KeyFormatDER:
+		default:
+			return "", nil, fmt.Errorf("encrypted keys must use the %s or %s key format", KeyFormatPKCS8, KeyFormatDER)
 		}
-		pemType = "EC PRIVATE KEY"
-	case ed25519.PrivateKey:
-		privKeyBytes, err = x509.MarshalPKCS8PrivateKey(key)
+		der, err := encryptPrivateKey(csrInfo.PrivKey, csrInfo.Passphrase, csrInfo.KDF)
 		if err != nil {
-			return CsrOutputInfo{}, fmt.Errorf("failed to marshal Ed25519 private key: %w", err)
+			return "", nil, err
 		}
-		pemType = "PRIVATE KEY"
-	default:
-		return CsrOutputInfo{}, errors.New("unsupported private key type")
+		if csrInfo.KeyFormat == KeyFormatDER {
+			return "", der, nil
+		}
+		encryptedPem := pem.EncodeToMemory(&pem.Block{
+			Type:  "ENCRYPTED PRIVATE KEY",
+			Bytes: der,
+		})
+		return string(encryptedPem), nil, nil
 	}
 
-	var outPrivPem []byte
+	privKeyBytes, pemType, err := MarshalPrivateKey(csrInfo.PrivKey, csrInfo.KeyFormat)
+	if err != nil {
+		return "", nil, err
+	}
+	if csrInfo.KeyFormat == KeyFormatDER {
+		return "", privKeyBytes, nil
+	}
 	privPem := pem.EncodeToMemory(&pem.Block{
 		Type:  pemType,
 		Bytes: privKeyBytes,
 	})
-	outPrivPem = privPem
+	return string(privPem), nil, nil
+}
 
-	return CsrOutputInfo{string(csrPem), string(outPrivPem)}, nil
+// MarshalPrivateKey encodes key in the given KeyFormat and returns the DER
+// bytes with the matching PEM block type. PKCS#1 is only valid for RSA keys
+// and SEC1 only for ECDSA keys.
+func MarshalPrivateKey(key crypto.PrivateKey, format string) ([]byte, string, error) {
+	if format == "" {
+		switch key.(type) {
+		case *rsa.PrivateKey:
+			format = KeyFormatPKCS1
+		case *ecdsa.PrivateKey:
+			format = KeyFormatSEC1
+		case ed25519.PrivateKey:
+			format = KeyFormatPKCS8
+		default:
+			return nil, "", errors.New("unsupported private key type")
+		}
+	}
+
+	switch format {
+	case KeyFormatPKCS1:
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, "", errors.New("the pkcs1 key format only supports RSA keys")
+		}
+		return x509.MarshalPKCS1PrivateKey(rsaKey), "RSA PRIVATE KEY", nil
+	case KeyFormatSEC1:
+		ecKey, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, "", errors.New("the sec1 key format only supports ECDSA keys")
+		}
+		der, err := x509.MarshalECPrivateKey(ecKey)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to marshal EC private key: %w", err)
+		}
+		return der, "EC PRIVATE KEY", nil
+	case KeyFormatPKCS8, KeyFormatDER:
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to marshal PKCS#8 private key: %w", err)
+		}
+		return der, "PRIVATE KEY", nil
+	default:
+		return nil, "", fmt.Errorf("unsupported key format: %s (use %s, %s, %s or %s)", format, KeyFormatPKCS1, KeyFormatSEC1, KeyFormatPKCS8, KeyFormatDER)
+	}
+}
+
+// EncryptPrivateKey returns key as an ENCRYPTED PRIVATE KEY PEM block, using
+// PBES2 with AES-256-CBC and the given KDF (KDFPBKDF2 if empty).
+func EncryptPrivateKey(key crypto.PrivateKey, passphrase []byte, kdf string) ([]byte, error) {
+	der, err := encryptPrivateKey(key, passphrase, kdf)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "ENCRYPTED PRIVATE KEY",
+		Bytes: der,
+	}), nil
+}
+
+func encryptPrivateKey(key crypto.PrivateKey, passphrase []byte, kdf string) ([]byte, error) {
+	opts := &pkcs8.Opts{Cipher: pkcs8.AES256CBC}
+	switch kdf {
+	case "", KDFPBKDF2:
+		// OWASP's recommendation for PBKDF2-HMAC-SHA256
+		opts.KDFOpts = pkcs8.PBKDF2Opts{SaltSize: 16, IterationCount: 600000, HMACHash: crypto.SHA256}
+	case KDFScrypt:
+		// N=2^14 is the largest cost OpenSSL reads within its default memory limit
+		opts.KDFOpts = pkcs8.ScryptOpts{SaltSize: 16, CostParameter: 1 << 14, BlockSize: 8, ParallelizationParameter: 1}
+	default:
+		return nil, fmt.Errorf("unsupported KDF: %s (use %s or %s)", kdf, KDFPBKDF2, KDFScrypt)
+	}
+	der, err := pkcs8.MarshalPrivateKey(key, passphrase, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt private key: %w", err)
+	}
+	return der, nil
+}
+
+// GenerateKey creates a private key of the given KeyType. bits is only used
+// for RSA; ECDSA keys use P-256.
+func GenerateKey(keyType string, bits int) (crypto.PrivateKey, error) {
+	switch keyType {
+	case KeyTypeRSA:
+		key, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't generate RSA private key: %w", err)
+		}
+		return key, nil
+	case KeyTypeECDSA:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't generate ECDSA private key: %w", err)
+		}
+		return key, nil
+	case KeyTypeEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't generate Ed25519 private key: %w", err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", keyType)
+	}
 }
 
 func NewCsrSecure(csrInfo CsrInputInfo) (CsrOutputInfo, error) {
@@ -4,6 +4,7 @@ Copyright © 2023 Dex Wood
 package gen
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/ed25519"
 	"crypto/elliptic"
@@ -15,6 +16,8 @@ import (
 	mathrand "math/rand"
 	"strings"
 	"testing"
+
+	"github.com/youmark/pkcs8"
 )
 
 type GenTestCase struct {
@@ -302,6 +305,169 @@ func TestOnlySans(t *testing.T) {
 	}
 }
 
+func TestEncryptedKey(t *testing.T) {
+	for _, kdf := range []string{KDFPBKDF2, KDFScrypt} {
+		t.Run(kdf, func(t *testing.T) {
+			key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			if err != nil {
+				t.Fatalf("Failed to generate ECDSA key: %v", err)
+			}
+			csrInfo := CsrInputInfo{
+				CommonName: "encrypted.example.com",
+				PrivKey:    key,
+				Passphrase: []byte("secret"),
+				KDF:        kdf,
+			}
+
+			csrOutput, err := NewCsrSecure(csrInfo)
+			if err != nil {
+				t.Fatalf("Failed to generate CSR: %v", err)
+			}
+			if !csrOutput.Encrypted {
+				t.Error("Expected output to be marked encrypted")
+			}
+
+			privBlock, _ := pem.Decode([]byte(csrOutput.PrivateKeyPem))
+			if privBlock == nil {
+				t.Fatal("Failed to decode private key PEM")
+			}
+			if privBlock.Type != "ENCRYPTED PRIVATE KEY" {
+				t.Errorf("Expected ENCRYPTED PRIVATE KEY, got %s", privBlock.Type)
+			}
+			if _, err := pkcs8.ParsePKCS8PrivateKey(privBlock.Bytes, []byte("wrong")); err == nil {
+				t.Error("Expected wrong passphrase to fail")
+			}
+			decrypted, err := pkcs8.ParsePKCS8PrivateKey(privBlock.Bytes, []byte("secret"))
+			if err != nil {
+				t.Fatalf("Failed to decrypt private key: %v", err)
+			}
+			if !key.Equal(decrypted) {
+				t.Error("Decrypted key does not match generated key")
+			}
+		})
+	}
+}
+
+func TestEncryptedKeyUnknownKDF(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %v", err)
+	}
+	if _, err := EncryptPrivateKey(key, []byte("secret"), "md5"); err == nil {
+		t.Error("Expected unsupported KDF to fail")
+	}
+}
+
+func TestKeyFormats(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ECDSA key: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		key     crypto.Signer
+		format  string
+		pemType string
+		wantErr bool
+	}{
+		{"rsa default", rsaKey, "", "RSA PRIVATE KEY", false},
+		{"rsa pkcs1", rsaKey, KeyFormatPKCS1, "RSA PRIVATE KEY", false},
+		{"rsa pkcs8", rsaKey, KeyFormatPKCS8, "PRIVATE KEY", false},
+		{"rsa der", rsaKey, KeyFormatDER, "", false},
+		{"rsa sec1", rsaKey, KeyFormatSEC1, "", true},
+		{"ecdsa sec1", ecKey, KeyFormatSEC1, "EC PRIVATE KEY", false},
+		{"ecdsa pkcs8", ecKey, KeyFormatPKCS8, "PRIVATE KEY", false},
+		{"ecdsa pkcs1", ecKey, KeyFormatPKCS1, "", true},
+		{"ed25519 der", edKey, KeyFormatDER, "", false},
+		{"ed25519 sec1", edKey, KeyFormatSEC1, "", true},
+		{"unknown", rsaKey, "pem", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			csrOutput, err := NewCsrSecure(CsrInputInfo{
+				CommonName: "format.example.com",
+				PrivKey:    tt.key,
+				KeyFormat:  tt.format,
+			})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Expected error for unsupported key format")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to generate CSR: %v", err)
+			}
+
+			der := csrOutput.PrivateKeyDer
+			if tt.format == KeyFormatDER {
+				if csrOutput.PrivateKeyPem != "" {
+					t.Error("Expected no PEM output for the der key format")
+				}
+			} else {
+				privBlock, _ := pem.Decode([]byte(csrOutput.PrivateKeyPem))
+				if privBlock == nil {
+					t.Fatal("Failed to decode private key PEM")
+				}
+				if privBlock.Type != tt.pemType {
+					t.Errorf("Expected %s, got %s", tt.pemType, privBlock.Type)
+				}
+				der = privBlock.Bytes
+			}
+
+			var parsed crypto.PrivateKey
+			switch {
+			case tt.pemType == "RSA PRIVATE KEY":
+				parsed, err = x509.ParsePKCS1PrivateKey(der)
+			case tt.pemType == "EC PRIVATE KEY":
+				parsed, err = x509.ParseECPrivateKey(der)
+			default:
+				parsed, err = x509.ParsePKCS8PrivateKey(der)
+			}
+			if err != nil {
+				t.Fatalf("Failed to parse private key: %v", err)
+			}
+			if !tt.key.(interface{ Equal(crypto.PrivateKey) bool }).Equal(parsed) {
+				t.Error("Parsed key does not match generated key")
+			}
+		})
+	}
+}
+
+func TestEncryptedKeyFormat(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ECDSA key: %v", err)
+	}
+	csrInfo := CsrInputInfo{
+		CommonName: "encrypted.example.com",
+		PrivKey:    key,
+		Passphrase: []byte("secret"),
+		KeyFormat:  KeyFormatDER,
+	}
+	csrOutput, err := NewCsrSecure(csrInfo)
+	if err != nil {
+		t.Fatalf("Failed to generate CSR: %v", err)
+	}
+	if _, err := pkcs8.ParsePKCS8PrivateKey(csrOutput.PrivateKeyDer, []byte("secret")); err != nil {
+		t.Errorf("Failed to decrypt DER private key: %v", err)
+	}
+
+	csrInfo.KeyFormat = KeyFormatSEC1
+	if _, err := NewCsrSecure(csrInfo); err == nil {
+		t.Error("Expected error encrypting a SEC1 key")
+	}
+}
+
 func stringSliceEqual(a, b []string) bool {
 	if len(a) != len(b) {
 		return false
@@ -0,0 +1,126 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package gen
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// SAN tags. An entry in CsrInputInfo.Sans may start with one of them to set
+// its type, e.g. "ip:10.0.0.5" or "uri:spiffe://example.org/web".
+const (
+	SanDNS   = "dns"
+	SanIP    = "ip"
+	SanEmail = "email"
+	SanURI   = "uri"
+)
+
+// SANs are subject alternative names sorted by type.
+type SANs struct {
+	DNSNames       []string
+	IPAddresses    []net.IP
+	EmailAddresses []string
+	URIs           []*url.URL
+}
+
+// ParseSANs sorts and validates entries. Untagged entries are IP addresses if
+// they parse as one, URIs if they contain ://, email addresses if they
+// contain an @ and DNS names otherwise. Other URIs, like URNs, need the uri:
+// tag.
+func ParseSANs(entries []string) (SANs, error) {
+	var sans SANs
+	for _, entry := range entries {
+		sanType, value := classifySAN(entry)
+		switch sanType {
+		case SanIP:
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return SANs{}, fmt.Errorf("invalid SAN %q: not an IP address", entry)
+			}
+			sans.IPAddresses = append(sans.IPAddresses, ip)
+		case SanEmail:
+			address, err := mail.ParseAddress(value)
+			if err != nil || address.Address != value {
+				return SANs{}, fmt.Errorf("invalid SAN %q: not an email address", entry)
+			}
+			sans.EmailAddresses = append(sans.EmailAddresses, value)
+		case SanURI:
+			uri, err := url.Parse(value)
+			if err != nil || uri.Scheme == "" || (uri.Host == "" && uri.Opaque == "" && uri.Path == "") {
+				return SANs{}, fmt.Errorf("invalid SAN %q: not an absolute URI", entry)
+			}
+			// x509 only accepts URIs with a domain name as the host
+			if uri.Host != "" && !isDNSName(uri.Hostname()) {
+				return SANs{}, fmt.Errorf("invalid SAN %q: the URI host must be a domain name", entry)
+			}
+			sans.URIs = append(sans.URIs, uri)
+		default:
+			if !isDNSName(value) {
+				return SANs{}, fmt.Errorf("invalid SAN %q: not a DNS name", entry)
+			}
+			sans.DNSNames = append(sans.DNSNames, value)
+		}
+	}
+	return sans, nil
+}
+
+func classifySAN(entry string) (string, string) {
+	tag, value, found := strings.Cut(entry, ":")
+	if found {
+		switch tag = strings.ToLower(tag); tag {
+		case SanDNS, SanIP, SanEmail, SanURI:
+			return tag, value
+		}
+	}
+	switch {
+	case net.ParseIP(entry) != nil:
+		return SanIP, entry
+	// URIs may have an @ in their user info
+	case strings.Contains(entry, "://"):
+		return SanURI, entry
+	case strings.Contains(entry, "@"):
+		return SanEmail, entry
+	}
+	return SanDNS, entry
+}
+
+// AddCommonName adds cn to the SANs unless it is already there, as an IP
+// address if it parses as one and as a DNS name if it is one. Other common
+// names, like "My Dev Cert", are skipped.
+func (sans *SANs) AddCommonName(cn string) {
+	if ip := net.ParseIP(cn); ip != nil {
+		if !slices.ContainsFunc(sans.IPAddresses, ip.Equal) {
+			sans.IPAddresses = append([]net.IP{ip}, sans.IPAddresses...)
+		}
+		return
+	}
+	if isDNSName(cn) && !slices.Contains(sans.DNSNames, cn) {
+		sans.DNSNames = append([]string{cn}, sans.DNSNames...)
+	}
+}
+
+// isDNSName reports whether name is a host name, optionally with a wildcard
+// as its first label.
+func isDNSName(name string) bool {
+	name = strings.TrimPrefix(name, "*.")
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
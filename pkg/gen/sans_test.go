@@ -0,0 +1,166 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package gen
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"testing"
+)
+
+func TestParseSANs(t *testing.T) {
+	tests := []struct {
+		entry    string
+		sanType  string
+		want     string
+		wantFail bool
+	}{
+		{"www.example.com", SanDNS, "www.example.com", false},
+		{"*.example.com", SanDNS, "*.example.com", false},
+		{"dns:localhost", SanDNS, "localhost", false},
+		{"10.0.0.5", SanIP, "10.0.0.5", false},
+		{"::1", SanIP, "::1", false},
+		{"IP:2001:db8::1", SanIP, "2001:db8::1", false},
+		{"admin@example.com", SanEmail, "admin@example.com", false},
+		{"email:admin@example.com", SanEmail, "admin@example.com", false},
+		{"spiffe://example.org/ns/prod/sa/web", SanURI, "spiffe://example.org/ns/prod/sa/web", false},
+		{"https://svc@example.com/", SanURI, "https://svc@example.com/", false},
+		{"uri:urn:uuid:f81d4fae-7dec-11d0-a765-00a0c91e6bf6", SanURI, "urn:uuid:f81d4fae-7dec-11d0-a765-00a0c91e6bf6", false},
+		{"not a name", "", "", true},
+		{"bad..example.com", "", "", true},
+		{"-bad.example.com", "", "", true},
+		{"ip:www.example.com", "", "", true},
+		{"email:Admin <admin@example.com>", "", "", true},
+		{"uri:no-scheme", "", "", true},
+		{"uri:https://[::1]/", "", "", true},
+		{"dns:", "", "", true},
+	}
+	for _, tt := range tests {
+		sans, err := ParseSANs([]string{tt.entry})
+		if tt.wantFail {
+			if err == nil {
+				t.Errorf("ParseSANs(%q): expected an error, got %+v", tt.entry, sans)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSANs(%q): %v", tt.entry, err)
+			continue
+		}
+		var got []string
+		switch tt.sanType {
+		case SanDNS:
+			got = sans.DNSNames
+		case SanIP:
+			for _, ip := range sans.IPAddresses {
+				got = append(got, ip.String())
+			}
+		case SanEmail:
+			got = sans.EmailAddresses
+		case SanURI:
+			for _, uri := range sans.URIs {
+				got = append(got, uri.String())
+			}
+		}
+		if len(got) != 1 || got[0] != tt.want {
+			t.Errorf("ParseSANs(%q) = %+v, want %s %s", tt.entry, sans, tt.sanType, tt.want)
+		}
+	}
+}
+
+func TestCsrSANTypes(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ECDSA key: %v", err)
+	}
+	csrOutput, err := NewCsrSecure(CsrInputInfo{
+		CommonName: "web.example.com",
+		Sans:       []string{"www.example.com", "10.0.0.5", "email:admin@example.com", "spiffe://example.org/web"},
+		PrivKey:    key,
+	})
+	if err != nil {
+		t.Fatalf("Failed to generate CSR: %v", err)
+	}
+	block, _ := pem.Decode([]byte(csrOutput.CsrPem))
+	if block == nil {
+		t.Fatal("Failed to decode CSR PEM")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse CSR: %v", err)
+	}
+	if !stringSliceEqual(csr.DNSNames, []string{"www.example.com"}) {
+		t.Errorf("DNS names mismatch: got %v", csr.DNSNames)
+	}
+	if len(csr.IPAddresses) != 1 || !csr.IPAddresses[0].Equal(net.ParseIP("10.0.0.5")) {
+		t.Errorf("IP addresses mismatch: got %v", csr.IPAddresses)
+	}
+	if !stringSliceEqual(csr.EmailAddresses, []string{"admin@example.com"}) {
+		t.Errorf("Email addresses mismatch: got %v", csr.EmailAddresses)
+	}
+	if len(csr.URIs) != 1 || csr.URIs[0].String() != "spiffe://example.org/web" {
+		t.Errorf("URIs mismatch: got %v", csr.URIs)
+	}
+
+	if _, err := NewCsrSecure(CsrInputInfo{CommonName: "web.example.com", Sans: []string{"ip:300.0.0.1"}, PrivKey: key}); err == nil {
+		t.Error("Expected an error for an invalid IP SAN")
+	}
+}
+
+func TestSelfSignedIPCommonName(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ECDSA key: %v", err)
+	}
+	certOutput, err := NewSelfSignedSecure(CsrInputInfo{CommonName: "10.0.0.5", Sans: []string{"localhost", "::1"}, PrivKey: key}, 30)
+	if err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+	block, _ := pem.Decode([]byte(certOutput.CertPem))
+	if block == nil {
+		t.Fatal("Failed to decode certificate PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	if !stringSliceEqual(cert.DNSNames, []string{"localhost"}) {
+		t.Errorf("DNS names mismatch: got %v", cert.DNSNames)
+	}
+	if len(cert.IPAddresses) != 2 || !cert.IPAddresses[0].Equal(net.ParseIP("10.0.0.5")) {
+		t.Errorf("IP addresses mismatch: got %v", cert.IPAddresses)
+	}
+	if err := cert.VerifyHostname("10.0.0.5"); err != nil {
+		t.Errorf("Failed to verify the IP address: %v", err)
+	}
+}
+
+func TestSelfSignedCommonNameNotDNSName(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ECDSA key: %v", err)
+	}
+	certOutput, err := NewSelfSignedSecure(CsrInputInfo{CommonName: "My Dev Cert", Sans: []string{"localhost"}, PrivKey: key}, 30)
+	if err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+	block, _ := pem.Decode([]byte(certOutput.CertPem))
+	if block == nil {
+		t.Fatal("Failed to decode certificate PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	if !stringSliceEqual(cert.DNSNames, []string{"localhost"}) {
+		t.Errorf("DNS names mismatch: got %v", cert.DNSNames)
+	}
+	if cert.Subject.CommonName != "My Dev Cert" {
+		t.Errorf("CommonName mismatch: got %s", cert.Subject.CommonName)
+	}
+}
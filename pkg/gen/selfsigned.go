@@ -0,0 +1,99 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package gen
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+)
+
+// DefaultDays is the validity of a self-signed certificate when none is given.
+const DefaultDays = 365
+
+type CertOutputInfo struct {
+	CertPem, PrivateKeyPem string
+	// PrivateKeyDer is set instead of PrivateKeyPem for KeyFormatDER.
+	PrivateKeyDer []byte
+	Encrypted     bool
+}
+
+// NewSelfSigned creates a certificate for the subject and SANs in csrInfo,
+// signed by its own key and valid for the given number of days. It is meant
+// for servers and clients in dev and lab environments, so it is not a CA.
+func NewSelfSigned(source io.Reader, csrInfo CsrInputInfo, days int) (CertOutputInfo, error) {
+	if csrInfo.CommonName == "" && len(csrInfo.Sans) == 0 {
+		return CertOutputInfo{}, errors.New("at least one of CommonName or SANs must be provided")
+	}
+	if days <= 0 {
+		return CertOutputInfo{}, errors.New("days must be positive")
+	}
+	signer, ok := csrInfo.PrivKey.(crypto.Signer)
+	if !ok {
+		return CertOutputInfo{}, errors.New("unsupported private key type")
+	}
+	if csrInfo.CommonName != "" {
+		csrInfo.Name.CommonName = csrInfo.CommonName
+	}
+	sans, err := ParseSANs(csrInfo.Sans)
+	if err != nil {
+		return CertOutputInfo{}, err
+	}
+	// clients only match against the SANs, so the common name is added to them
+	sans.AddCommonName(csrInfo.CommonName)
+
+	serial, err := rand.Int(source, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return CertOutputInfo{}, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	// backdated a little so clients with a slow clock accept it right away
+	notBefore := time.Now().Add(-5 * time.Minute).UTC()
+	keyUsage := x509.KeyUsageDigitalSignature
+	if _, isRSA := signer.(*rsa.PrivateKey); isRSA {
+		keyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               csrInfo.Name,
+		DNSNames:              sans.DNSNames,
+		IPAddresses:           sans.IPAddresses,
+		EmailAddresses:        sans.EmailAddresses,
+		URIs:                  sans.URIs,
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.AddDate(0, 0, days),
+		KeyUsage:              keyUsage,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(source, template, template, signer.Public(), signer)
+	if err != nil {
+		return CertOutputInfo{}, fmt.Errorf("failed to create certificate: %w", err)
+	}
+	certPem := pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: der,
+	})
+
+	keyPem, keyDer, err := encodePrivateKey(csrInfo)
+	if err != nil {
+		return CertOutputInfo{}, err
+	}
+	return CertOutputInfo{
+		CertPem:       string(certPem),
+		PrivateKeyPem: keyPem,
+		PrivateKeyDer: keyDer,
+		Encrypted:     len(csrInfo.Passphrase) > 0,
+	}, nil
+}
+
+func NewSelfSignedSecure(csrInfo CsrInputInfo, days int) (CertOutputInfo, error) {
+	return NewSelfSigned(rand.Reader, csrInfo, days)
+}
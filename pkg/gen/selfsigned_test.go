@@ -0,0 +1,104 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package gen
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"testing"
+	"time"
+)
+
+func TestSelfSigned(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ECDSA key: %v", err)
+	}
+	csrInfo := CsrInputInfo{
+		CommonName: "dev.example.com",
+		Sans:       []string{"www.dev.example.com"},
+		Name:       pkix.Name{Organization: []string{"Test Org"}},
+		PrivKey:    key,
+	}
+
+	certOutput, err := NewSelfSignedSecure(csrInfo, 30)
+	if err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+	block, _ := pem.Decode([]byte(certOutput.CertPem))
+	if block == nil || block.Type != "CERTIFICATE" {
+		t.Fatal("Failed to decode certificate PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+
+	if cert.Subject.CommonName != "dev.example.com" || !stringSliceEqual(cert.Subject.Organization, []string{"Test Org"}) {
+		t.Errorf("Subject mismatch: got %s", cert.Subject)
+	}
+	if !stringSliceEqual(cert.DNSNames, []string{"dev.example.com", "www.dev.example.com"}) {
+		t.Errorf("SANs mismatch: got %v", cert.DNSNames)
+	}
+	if cert.IsCA {
+		t.Error("Expected a non-CA certificate")
+	}
+	if cert.KeyUsage != x509.KeyUsageDigitalSignature {
+		t.Errorf("Unexpected key usage for ECDSA: %v", cert.KeyUsage)
+	}
+	if validity := cert.NotAfter.Sub(cert.NotBefore); validity != 30*24*time.Hour {
+		t.Errorf("Validity mismatch: got %s", validity)
+	}
+	if err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil {
+		t.Errorf("Certificate is not self-signed: %v", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	if _, err := cert.Verify(x509.VerifyOptions{DNSName: "www.dev.example.com", Roots: roots}); err != nil {
+		t.Errorf("Failed to verify certificate: %v", err)
+	}
+
+	privBlock, _ := pem.Decode([]byte(certOutput.PrivateKeyPem))
+	if privBlock == nil || privBlock.Type != "EC PRIVATE KEY" {
+		t.Fatal("Failed to decode private key PEM")
+	}
+}
+
+func TestSelfSignedRSAKeyUsage(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	certOutput, err := NewSelfSignedSecure(CsrInputInfo{Sans: []string{"rsa.example.com"}, PrivKey: key}, DefaultDays)
+	if err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+	block, _ := pem.Decode([]byte(certOutput.CertPem))
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	if cert.KeyUsage != x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment {
+		t.Errorf("Unexpected key usage for RSA: %v", cert.KeyUsage)
+	}
+}
+
+func TestSelfSignedInvalid(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ECDSA key: %v", err)
+	}
+	if _, err := NewSelfSignedSecure(CsrInputInfo{PrivKey: key}, DefaultDays); err == nil {
+		t.Error("Expected error when CommonName and SANs are empty")
+	}
+	if _, err := NewSelfSignedSecure(CsrInputInfo{CommonName: "x.example.com", PrivKey: key}, 0); err == nil {
+		t.Error("Expected error for zero days")
+	}
+}
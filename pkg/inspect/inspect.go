@@ -0,0 +1,282 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package inspect
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"ssltool/pkg/details"
+
+	"github.com/youmark/pkcs8"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+const (
+	KindCertificate = "certificate"
+	KindRequest     = "certificate request"
+	KindCRL         = "crl"
+	KindPrivateKey  = "private key"
+	KindPublicKey   = "public key"
+	KindPKCS7       = "pkcs7"
+	KindPKCS12      = "pkcs12"
+)
+
+const (
+	EncodingPEM = "PEM"
+	EncodingDER = "DER"
+)
+
+// Object is one item found in a file. Which fields are set depends on Kind.
+type Object struct {
+	Kind     string
+	Encoding string
+	// Certificates holds the certificate, or the bundle in a PKCS#7 or
+	// PKCS#12 file, in file order.
+	Certificates []details.CertDetails
+	Request      *x509.CertificateRequest
+	CRL          *x509.RevocationList
+	PrivateKey   crypto.PrivateKey
+	PublicKey    crypto.PublicKey
+	// Encrypted is set for private keys that could not be decrypted.
+	Encrypted bool
+}
+
+// ParseFile reads a file and parses it with Parse.
+func ParseFile(path, password string) ([]Object, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, password)
+}
+
+// Parse detects whether data is PEM or DER and what it contains. A PEM file
+// may contain several objects. password is used for PKCS#12 and encrypted
+// private keys; without one encrypted keys are returned with Encrypted set
+// and no PrivateKey.
+func Parse(data []byte, password string) ([]Object, error) {
+	block, rest := pem.Decode(data)
+	if block == nil {
+		object, err := parseDER(data, password)
+		if err != nil {
+			return nil, err
+		}
+		return []Object{object}, nil
+	}
+	var objects []Object
+	for ; block != nil; block, rest = pem.Decode(rest) {
+		object, ok, err := parsePEM(block, password)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			objects = append(objects, object)
+		}
+	}
+	if len(objects) == 0 {
+		return nil, errors.New("no supported PEM blocks found")
+	}
+	return objects, nil
+}
+
+// parsePEM returns false for block types that aren't supported, such as
+// EC PARAMETERS written before an EC key.
+func parsePEM(block *pem.Block, password string) (Object, bool, error) {
+	object := Object{Encoding: EncodingPEM}
+	var err error
+	switch block.Type {
+	case "CERTIFICATE", "TRUSTED CERTIFICATE":
+		var cert *x509.Certificate
+		cert, err = x509.ParseCertificate(block.Bytes)
+		if err == nil {
+			object.Kind = KindCertificate
+			object.Certificates = certDetails(cert)
+		}
+	case "CERTIFICATE REQUEST", "NEW CERTIFICATE REQUEST":
+		object.Kind = KindRequest
+		object.Request, err = x509.ParseCertificateRequest(block.Bytes)
+	case "X509 CRL":
+		object.Kind = KindCRL
+		object.CRL, err = x509.ParseRevocationList(block.Bytes)
+	case "PRIVATE KEY", "RSA PRIVATE KEY", "EC PRIVATE KEY", "ENCRYPTED PRIVATE KEY":
+		object.Kind = KindPrivateKey
+		object.Encrypted = block.Type == "ENCRYPTED PRIVATE KEY" || block.Headers["Proc-Type"] != ""
+		if object.Encrypted && password == "" {
+			break
+		}
+		object.PrivateKey, err = decryptPrivateKey(block, password)
+		if err == nil {
+			object.PublicKey, err = publicKey(object.PrivateKey)
+		}
+	case "PUBLIC KEY":
+		object.Kind = KindPublicKey
+		object.PublicKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "PKCS7":
+		var certs []*x509.Certificate
+		certs, err = details.ParsePKCS7Certificates(block.Bytes)
+		if err == nil {
+			object.Kind = KindPKCS7
+			object.Certificates = certDetails(certs...)
+		}
+	default:
+		return Object{}, false, nil
+	}
+	if err != nil {
+		return Object{}, false, fmt.Errorf("failed to parse %s: %w", block.Type, err)
+	}
+	return object, true, nil
+}
+
+func parseDER(data []byte, password string) (Object, error) {
+	object := Object{Encoding: EncodingDER}
+	if cert, err := x509.ParseCertificate(data); err == nil {
+		object.Kind = KindCertificate
+		object.Certificates = certDetails(cert)
+		return object, nil
+	}
+	if request, err := x509.ParseCertificateRequest(data); err == nil {
+		object.Kind = KindRequest
+		object.Request = request
+		return object, nil
+	}
+	if crl, err := x509.ParseRevocationList(data); err == nil {
+		object.Kind = KindCRL
+		object.CRL = crl
+		return object, nil
+	}
+	if key, err := parsePrivateKey(data); err == nil {
+		object.Kind = KindPrivateKey
+		object.PrivateKey = key
+		object.PublicKey, err = publicKey(key)
+		return object, err
+	}
+	// encrypted PKCS#8 has no PEM type to identify it, e.g. from gen --key-format der --encrypt
+	if isEncryptedPKCS8(data) {
+		object.Kind = KindPrivateKey
+		object.Encrypted = true
+		if password == "" {
+			return object, nil
+		}
+		key, err := pkcs8.ParsePKCS8PrivateKey(data, []byte(password))
+		if err != nil {
+			return Object{}, fmt.Errorf("failed to decrypt private key: %w", err)
+		}
+		object.PrivateKey = key
+		object.PublicKey, err = publicKey(key)
+		return object, err
+	}
+	if key, err := x509.ParsePKIXPublicKey(data); err == nil {
+		object.Kind = KindPublicKey
+		object.PublicKey = key
+		return object, nil
+	}
+	if certs, err := details.ParsePKCS7Certificates(data); err == nil {
+		object.Kind = KindPKCS7
+		object.Certificates = certDetails(certs...)
+		return object, nil
+	}
+	return parsePKCS12(data, password)
+}
+
+func parsePKCS12(data []byte, password string) (Object, error) {
+	object := Object{Kind: KindPKCS12, Encoding: EncodingDER}
+	key, leaf, caCerts, err := pkcs12.DecodeChain(data, password)
+	if errors.Is(err, pkcs12.ErrIncorrectPassword) {
+		return Object{}, errors.New("incorrect PKCS#12 password")
+	}
+	if err == nil {
+		object.PrivateKey = key
+		if object.PublicKey, err = publicKey(key); err != nil {
+			return Object{}, err
+		}
+		object.Certificates = certDetails(append([]*x509.Certificate{leaf}, caCerts...)...)
+		return object, nil
+	}
+	// a trust store has certificates but no key
+	certs, trustErr := pkcs12.DecodeTrustStore(data, password)
+	if trustErr != nil {
+		return Object{}, errors.New("unrecognized file: not a certificate, request, CRL, key, PKCS#7 or PKCS#12")
+	}
+	object.Certificates = certDetails(certs...)
+	return object, nil
+}
+
+// isEncryptedPKCS8 reports whether der is an EncryptedPrivateKeyInfo (RFC
+// 5208 section 6) with a PKCS#5 or PKCS#12 encryption algorithm.
+func isEncryptedPKCS8(der []byte) bool {
+	var info struct {
+		Algorithm     pkix.AlgorithmIdentifier
+		EncryptedData []byte
+	}
+	rest, err := asn1.Unmarshal(der, &info)
+	if err != nil || len(rest) > 0 {
+		return false
+	}
+	pkcs5 := asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5}
+	pkcs12PBE := asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1}
+	return hasPrefix(info.Algorithm.Algorithm, pkcs5) || hasPrefix(info.Algorithm.Algorithm, pkcs12PBE)
+}
+
+func hasPrefix(oid, prefix asn1.ObjectIdentifier) bool {
+	return len(oid) > len(prefix) && oid[:len(prefix)].Equal(prefix)
+}
+
+// publicKey returns the public key of a private key. X25519 keys have one
+// too, but they aren't a crypto.Signer.
+func publicKey(key crypto.PrivateKey) (crypto.PublicKey, error) {
+	if key, ok := key.(interface{ Public() crypto.PublicKey }); ok {
+		return key.Public(), nil
+	}
+	return nil, fmt.Errorf("unsupported private key type %T", key)
+}
+
+// decryptPrivateKey parses a private key PEM block, decrypting encrypted
+// PKCS#8 and legacy OpenSSL encrypted keys with password.
+func decryptPrivateKey(block *pem.Block, password string) (crypto.PrivateKey, error) {
+	switch {
+	case block.Type == "ENCRYPTED PRIVATE KEY":
+		key, err := pkcs8.ParsePKCS8PrivateKey(block.Bytes, []byte(password))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+		}
+		return key, nil
+	case block.Headers["Proc-Type"] != "":
+		// legacy encryption is deprecated but still written by e.g. openssl genrsa -aes256
+		der, err := x509.DecryptPEMBlock(block, []byte(password))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+		}
+		return parsePrivateKey(der)
+	default:
+		return parsePrivateKey(block.Bytes)
+	}
+}
+
+func parsePrivateKey(der []byte) (crypto.PrivateKey, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("unsupported private key format")
+}
+
+// certDetails converts certificates to CertDetails, keeping their order.
+func certDetails(certs ...*x509.Certificate) []details.CertDetails {
+	chain := make([]details.CertDetails, len(certs))
+	for i, cert := range certs {
+		chain[i] = details.NewCertDetails(cert)
+	}
+	return chain
+}
@@ -0,0 +1,275 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package inspect
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/youmark/pkcs8"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+type testFiles struct {
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+	csr  []byte
+	crl  []byte
+}
+
+func newTestFiles(t *testing.T) testFiles {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		DNSNames:              []string{"www.example.com"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "www.example.com"},
+		DNSNames: []string{"www.example.com"},
+	}, key)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now(),
+		NextUpdate: time.Now().Add(time.Hour),
+	}, cert, key)
+	if err != nil {
+		t.Fatalf("failed to create CRL: %v", err)
+	}
+	return testFiles{key: key, cert: cert, csr: csr, crl: crl}
+}
+
+func TestParse_DER(t *testing.T) {
+	files := newTestFiles(t)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(files.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := x509.MarshalPKIXPublicKey(&files.key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p12, err := pkcs12.Modern.Encode(files.key, files.cert, nil, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"certificate", files.cert.Raw, KindCertificate},
+		{"request", files.csr, KindRequest},
+		{"crl", files.crl, KindCRL},
+		{"private key", pkcs8, KindPrivateKey},
+		{"public key", public, KindPublicKey},
+		{"pkcs12", p12, KindPKCS12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects, err := Parse(tt.data, "secret")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(objects) != 1 || objects[0].Kind != tt.want || objects[0].Encoding != EncodingDER {
+				t.Fatalf("expected one DER %s, got %+v", tt.want, objects)
+			}
+		})
+	}
+
+	if _, err := Parse(p12, "wrong"); err == nil {
+		t.Error("expected an error for a wrong PKCS#12 password")
+	}
+	if _, err := Parse([]byte("not a certificate"), ""); err == nil {
+		t.Error("expected an error for unrecognized data")
+	}
+}
+
+func TestParseFile_PEMBundle(t *testing.T) {
+	files := newTestFiles(t)
+	sec1, err := x509.MarshalECPrivateKey(files.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data []byte
+	for _, block := range []*pem.Block{
+		{Type: "CERTIFICATE", Bytes: files.cert.Raw},
+		{Type: "CERTIFICATE REQUEST", Bytes: files.csr},
+		{Type: "X509 CRL", Bytes: files.crl},
+		{Type: "EC PARAMETERS", Bytes: []byte{0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07}},
+		{Type: "EC PRIVATE KEY", Bytes: sec1},
+		{Type: "ENCRYPTED PRIVATE KEY", Bytes: []byte{0x30, 0x00}},
+	} {
+		data = append(data, pem.EncodeToMemory(block)...)
+	}
+	path := filepath.Join(t.TempDir(), "bundle.pem")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	objects, err := ParseFile(path, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{KindCertificate, KindRequest, KindCRL, KindPrivateKey, KindPrivateKey}
+	if len(objects) != len(want) {
+		t.Fatalf("expected %d objects, got %d", len(want), len(objects))
+	}
+	for i, kind := range want {
+		if objects[i].Kind != kind || objects[i].Encoding != EncodingPEM {
+			t.Errorf("object %d mismatch; got %s %s, want PEM %s", i, objects[i].Encoding, objects[i].Kind, kind)
+		}
+	}
+	if objects[3].PrivateKey == nil || objects[3].Encrypted {
+		t.Error("expected the EC key to be parsed")
+	}
+	if !objects[4].Encrypted {
+		t.Error("expected the PKCS#8 key to be marked encrypted")
+	}
+
+	report := NewReport(path, objects)
+	if len(report.Objects) != len(want) {
+		t.Fatalf("expected %d objects in the report, got %d", len(want), len(report.Objects))
+	}
+	if report.Objects[0].Certificates[0].Subject != "CN=Test CA" {
+		t.Errorf("unexpected certificate report: %+v", report.Objects[0].Certificates)
+	}
+	if request := report.Objects[1].Request; request == nil || !request.SignatureValid || request.KeyAlgorithm != "ECDSA-P-256" {
+		t.Errorf("unexpected request report: %+v", request)
+	}
+	if crl := report.Objects[2].CRL; crl == nil || crl.Number != "1" {
+		t.Errorf("unexpected CRL report: %+v", crl)
+	}
+	if key := report.Objects[3].Key; key == nil || !key.Private || key.Algorithm != "ECDSA-P-256" {
+		t.Errorf("unexpected key report: %+v", key)
+	}
+}
+
+func TestParse_X25519Key(t *testing.T) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range [][]byte{der, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})} {
+		objects, err := Parse(data, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if objects[0].Kind != KindPrivateKey || !key.PublicKey().Equal(objects[0].PublicKey) {
+			t.Errorf("expected the X25519 key, got %+v", objects[0])
+		}
+	}
+}
+
+func TestParse_EncryptedKeys(t *testing.T) {
+	files := newTestFiles(t)
+	encrypted, err := pkcs8.MarshalPrivateKey(files.key, []byte("secret"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec1, err := x509.MarshalECPrivateKey(files.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// EncryptPEMBlock is deprecated, but the legacy format is what is being tested
+	legacy, err := x509.EncryptPEMBlock(rand.Reader, "EC PRIVATE KEY", sec1, []byte("secret"), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"pkcs8", pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: encrypted})},
+		{"legacy", pem.EncodeToMemory(legacy)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects, err := Parse(tt.data, "")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !objects[0].Encrypted || objects[0].PrivateKey != nil {
+				t.Errorf("expected an encrypted key without a password, got %+v", objects[0])
+			}
+
+			objects, err = Parse(tt.data, "secret")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !objects[0].Encrypted || !files.key.PublicKey.Equal(objects[0].PublicKey) {
+				t.Errorf("expected the decrypted key, got %+v", objects[0])
+			}
+
+			if _, err := Parse(tt.data, "wrong"); err == nil {
+				t.Error("expected an error for a wrong password")
+			}
+		})
+	}
+}
+
+func TestParse_EncryptedDERKey(t *testing.T) {
+	files := newTestFiles(t)
+	encrypted, err := pkcs8.MarshalPrivateKey(files.key, []byte("secret"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	objects, err := Parse(encrypted, "secret")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if objects[0].Kind != KindPrivateKey || !objects[0].Encrypted || !files.key.PublicKey.Equal(objects[0].PublicKey) {
+		t.Errorf("expected the decrypted key, got %+v", objects[0])
+	}
+
+	// without a passphrase the key is still recognized so callers can ask for one
+	objects, err = Parse(encrypted, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if objects[0].Kind != KindPrivateKey || !objects[0].Encrypted || objects[0].PrivateKey != nil {
+		t.Errorf("expected an encrypted key, got %+v", objects[0])
+	}
+	if _, err := Parse(encrypted, "wrong"); err == nil {
+		t.Error("expected an error for a wrong passphrase")
+	}
+}
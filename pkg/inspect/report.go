@@ -0,0 +1,99 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package inspect
+
+import (
+	"crypto/x509"
+	"ssltool/pkg/details"
+	"ssltool/pkg/revocation"
+)
+
+// Report is the machine-readable form of an inspected file. It uses the same
+// schema version as details.Report.
+type Report struct {
+	SchemaVersion int            `json:"schema_version" yaml:"schema_version"`
+	File          string         `json:"file" yaml:"file"`
+	Objects       []ObjectReport `json:"objects" yaml:"objects"`
+}
+
+type ObjectReport struct {
+	Kind         string                      `json:"kind" yaml:"kind"`
+	Encoding     string                      `json:"encoding" yaml:"encoding"`
+	Certificates []details.CertificateReport `json:"certificates,omitempty" yaml:"certificates,omitempty"`
+	Request      *RequestReport              `json:"request,omitempty" yaml:"request,omitempty"`
+	CRL          *revocation.CRLInfo         `json:"crl,omitempty" yaml:"crl,omitempty"`
+	Key          *KeyReport                  `json:"key,omitempty" yaml:"key,omitempty"`
+}
+
+type RequestReport struct {
+	Subject            string   `json:"subject" yaml:"subject"`
+	DNSNames           []string `json:"dns_names" yaml:"dns_names"`
+	IPAddresses        []string `json:"ip_addresses,omitempty" yaml:"ip_addresses,omitempty"`
+	EmailAddresses     []string `json:"email_addresses,omitempty" yaml:"email_addresses,omitempty"`
+	URIs               []string `json:"uris,omitempty" yaml:"uris,omitempty"`
+	KeyAlgorithm       string   `json:"key_algorithm" yaml:"key_algorithm"`
+	SignatureAlgorithm string   `json:"signature_algorithm" yaml:"signature_algorithm"`
+	SignatureValid     bool     `json:"signature_valid" yaml:"signature_valid"`
+}
+
+type KeyReport struct {
+	Private   bool   `json:"private" yaml:"private"`
+	Algorithm string `json:"algorithm,omitempty" yaml:"algorithm,omitempty"`
+	Encrypted bool   `json:"encrypted" yaml:"encrypted"`
+}
+
+func NewReport(file string, objects []Object) Report {
+	report := Report{
+		SchemaVersion: details.SchemaVersion,
+		File:          file,
+		Objects:       make([]ObjectReport, 0, len(objects)),
+	}
+	for _, object := range objects {
+		objectReport := ObjectReport{Kind: object.Kind, Encoding: object.Encoding}
+		if len(object.Certificates) > 0 {
+			objectReport.Certificates = details.NewReport("", object.Certificates).Certificates
+		}
+		if object.Request != nil {
+			request := NewRequestReport(object.Request)
+			objectReport.Request = &request
+		}
+		if object.CRL != nil {
+			crl := revocation.NewCRLInfo(object.CRL)
+			objectReport.CRL = &crl
+		}
+		if object.PublicKey != nil || object.Encrypted {
+			objectReport.Key = &KeyReport{
+				Private:   object.Kind != KindPublicKey,
+				Algorithm: details.PublicKeyAlgorithm(object.PublicKey),
+				Encrypted: object.Encrypted,
+			}
+		}
+		report.Objects = append(report.Objects, objectReport)
+	}
+	return report
+}
+
+func NewRequestReport(request *x509.CertificateRequest) RequestReport {
+	report := RequestReport{
+		Subject:            request.Subject.String(),
+		DNSNames:           request.DNSNames,
+		EmailAddresses:     request.EmailAddresses,
+		KeyAlgorithm:       details.PublicKeyAlgorithm(request.PublicKey),
+		SignatureAlgorithm: request.SignatureAlgorithm.String(),
+		SignatureValid:     request.CheckSignature() == nil,
+	}
+	if report.DNSNames == nil {
+		report.DNSNames = []string{}
+	}
+	if report.KeyAlgorithm == "" {
+		report.KeyAlgorithm = request.PublicKeyAlgorithm.String()
+	}
+	for _, ip := range request.IPAddresses {
+		report.IPAddresses = append(report.IPAddresses, ip.String())
+	}
+	for _, uri := range request.URIs {
+		report.URIs = append(report.URIs, uri.String())
+	}
+	return report
+}
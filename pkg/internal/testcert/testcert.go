@@ -0,0 +1,94 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package testcert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Cert is a certificate and its private key.
+type Cert struct {
+	Cert *x509.Certificate
+	Key  crypto.Signer
+}
+
+var serial atomic.Int64
+
+// Issue signs a certificate for template with issuer, or self-signs it when
+// issuer is nil. The key is a new P-256 key and the serial number is unique.
+// Unless set, the certificate is valid from an hour ago for a day.
+func Issue(t testing.TB, template *x509.Certificate, issuer *Cert) *Cert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template.SerialNumber = big.NewInt(100 + serial.Add(1))
+	if template.NotBefore.IsZero() {
+		template.NotBefore = time.Now().Add(-time.Hour)
+	}
+	if template.NotAfter.IsZero() {
+		template.NotAfter = time.Now().Add(24 * time.Hour)
+	}
+	parent, signer := template, crypto.Signer(key)
+	if issuer != nil {
+		parent, signer = issuer.Cert, issuer.Key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	return &Cert{Cert: cert, Key: key}
+}
+
+// NewCA issues a CA certificate named cn with issuer, or a self-signed one
+// when issuer is nil.
+func NewCA(t testing.TB, cn string, issuer *Cert) *Cert {
+	t.Helper()
+	return Issue(t, CATemplate(cn), issuer)
+}
+
+// NewChain returns a root, an intermediate signed by it and a leaf for
+// www.example.com signed by the intermediate.
+func NewChain(t testing.TB) (root, intermediate, leaf *Cert) {
+	t.Helper()
+	root = NewCA(t, "Test Root", nil)
+	intermediate = NewCA(t, "Test Intermediate", root)
+	leaf = Issue(t, LeafTemplate("www.example.com"), intermediate)
+	return root, intermediate, leaf
+}
+
+// CATemplate returns a CA certificate template named cn.
+func CATemplate(cn string) *x509.Certificate {
+	return &x509.Certificate{
+		Subject:               pkix.Name{CommonName: cn},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+}
+
+// LeafTemplate returns a server certificate template for names, the first
+// of which is also the common name.
+func LeafTemplate(names ...string) *x509.Certificate {
+	return &x509.Certificate{
+		Subject:     pkix.Name{CommonName: names[0]},
+		DNSNames:    names,
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package match
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"ssltool/pkg/details"
+	"ssltool/pkg/inspect"
+)
+
+// ErrPassphraseRequired is returned by Load for an encrypted key when no
+// password was given.
+var ErrPassphraseRequired = errors.New("the private key is encrypted; a passphrase is required")
+
+// Item is a public key found in a key, CSR or certificate file.
+type Item struct {
+	File      string           `json:"file" yaml:"file"`
+	Kind      string           `json:"kind" yaml:"kind"`
+	Subject   string           `json:"subject,omitempty" yaml:"subject,omitempty"`
+	Algorithm string           `json:"algorithm" yaml:"algorithm"`
+	SPKIPin   string           `json:"spki_pin" yaml:"spki_pin"`
+	PublicKey crypto.PublicKey `json:"-" yaml:"-"`
+}
+
+type Result struct {
+	Match bool   `json:"match" yaml:"match"`
+	Items []Item `json:"items" yaml:"items"`
+}
+
+// Load returns the public key of each key, CSR and certificate in the file.
+// Only the first certificate in the file is used since the rest of a
+// bundle are its issuers. Encrypted keys are decrypted with password.
+func Load(path, password string) ([]Item, error) {
+	objects, err := inspect.ParseFile(path, password)
+	if err != nil {
+		return nil, err
+	}
+	var items []Item
+	add := func(kind, subject string, publicKey crypto.PublicKey) {
+		items = append(items, Item{File: path, Kind: kind, Subject: subject, PublicKey: publicKey})
+	}
+	// a PEM bundle has one object per certificate
+	haveCert := false
+	for _, object := range objects {
+		switch {
+		case object.Kind == inspect.KindPrivateKey && object.PrivateKey == nil:
+			return nil, fmt.Errorf("%s: %w", path, ErrPassphraseRequired)
+		case object.Request != nil:
+			add(inspect.KindRequest, object.Request.Subject.String(), object.Request.PublicKey)
+		case object.PublicKey != nil:
+			kind := object.Kind
+			if kind == inspect.KindPKCS12 {
+				kind = inspect.KindPrivateKey
+			}
+			add(kind, "", object.PublicKey)
+		}
+		// a PKCS#12 file has both a key and a certificate, which are compared too
+		if len(object.Certificates) > 0 && !haveCert {
+			haveCert = true
+			cert := object.Certificates[0].Cert
+			add(inspect.KindCertificate, cert.Subject.String(), cert.PublicKey)
+		}
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("%s: no key, certificate request or certificate found", path)
+	}
+	for i := range items {
+		if err := describe(&items[i]); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return items, nil
+}
+
+func describe(item *Item) error {
+	der, err := x509.MarshalPKIXPublicKey(item.PublicKey)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(der)
+	item.SPKIPin = base64.StdEncoding.EncodeToString(sum[:])
+	item.Algorithm = details.PublicKeyAlgorithm(item.PublicKey)
+	return nil
+}
+
+// Compare reports whether all items have the same public key.
+func Compare(items []Item) (Result, error) {
+	if len(items) < 2 {
+		return Result{}, errors.New("at least two keys, requests or certificates are needed")
+	}
+	result := Result{Match: true, Items: items}
+	first, ok := items[0].PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return Result{}, fmt.Errorf("unsupported public key type %T", items[0].PublicKey)
+	}
+	for _, item := range items[1:] {
+		if !first.Equal(item.PublicKey) {
+			result.Match = false
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,200 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package match
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/youmark/pkcs8"
+)
+
+// writeKeySet writes a PKCS#8 key, a CSR and a self-signed certificate for
+// key to dir and returns their paths.
+func writeKeySet(t *testing.T, dir, name string, key crypto.Signer) (keyFile, csrFile, certFile string) {
+	t.Helper()
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrDer, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: name},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDer, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile = writePem(t, filepath.Join(dir, name+".key"), "PRIVATE KEY", keyDer)
+	csrFile = writePem(t, filepath.Join(dir, name+".csr"), "CERTIFICATE REQUEST", csrDer)
+	certFile = writePem(t, filepath.Join(dir, name+".crt"), "CERTIFICATE", certDer)
+	return keyFile, csrFile, certFile
+}
+
+func writePem(t *testing.T, path, pemType string, der []byte) string {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func loadAll(t *testing.T, password string, paths ...string) []Item {
+	t.Helper()
+	var items []Item
+	for _, path := range paths {
+		loaded, err := Load(path, password)
+		if err != nil {
+			t.Fatalf("failed to load %s: %v", path, err)
+		}
+		items = append(items, loaded...)
+	}
+	return items
+}
+
+func TestCompare(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name      string
+		key       crypto.Signer
+		algorithm string
+	}{
+		{"rsa", rsaKey, "RSA-2048"},
+		{"ecdsa", ecKey, "ECDSA-P-256"},
+		{"ed25519", edKey, "Ed25519"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			keyFile, csrFile, certFile := writeKeySet(t, dir, tt.name, tt.key)
+			result, err := Compare(loadAll(t, "", keyFile, csrFile, certFile))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !result.Match {
+				t.Error("expected the key, CSR and certificate to match")
+			}
+			want := []string{"private key", "certificate request", "certificate"}
+			for i, item := range result.Items {
+				if item.Kind != want[i] || item.Algorithm != tt.algorithm || item.SPKIPin != result.Items[0].SPKIPin {
+					t.Errorf("unexpected item %d: %+v", i, item)
+				}
+			}
+		})
+	}
+
+	_, _, rsaCert := writeKeySet(t, dir, "rsa", rsaKey)
+	ecKeyFile, _, _ := writeKeySet(t, dir, "ecdsa", ecKey)
+	result, err := Compare(loadAll(t, "", ecKeyFile, rsaCert))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Match {
+		t.Error("expected different keys not to match")
+	}
+}
+
+func TestLoad_EncryptedKey(t *testing.T) {
+	dir := t.TempDir()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, certFile := writeKeySet(t, dir, "server", key)
+	encrypted, err := pkcs8.MarshalPrivateKey(key, []byte("secret"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := writePem(t, filepath.Join(dir, "encrypted.key"), "ENCRYPTED PRIVATE KEY", encrypted)
+
+	derFile := filepath.Join(dir, "encrypted.der")
+	if err := os.WriteFile(derFile, encrypted, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range []string{keyFile, derFile} {
+		if _, err := Load(file, ""); !errors.Is(err, ErrPassphraseRequired) {
+			t.Errorf("%s: expected ErrPassphraseRequired without a passphrase, got %v", file, err)
+		}
+	}
+	result, err := Compare(loadAll(t, "secret", keyFile, certFile))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Match {
+		t.Error("expected the decrypted key to match the certificate")
+	}
+}
+
+func TestLoad_FullChain(t *testing.T) {
+	dir := t.TempDir()
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile, _, leafCert := writeKeySet(t, dir, "leaf", leafKey)
+	_, _, caCert := writeKeySet(t, dir, "ca", caKey)
+	var bundle []byte
+	for _, path := range []string{leafCert, caCert} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bundle = append(bundle, data...)
+	}
+	fullchain := filepath.Join(dir, "fullchain.pem")
+	if err := os.WriteFile(fullchain, bundle, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Compare(loadAll(t, "", keyFile, fullchain))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Match || len(result.Items) != 2 || result.Items[1].Subject != "CN=leaf" {
+		t.Errorf("expected the key to match the first certificate of the bundle, got %+v", result.Items)
+	}
+}
+
+func TestCompare_TooFew(t *testing.T) {
+	if _, err := Compare([]Item{{}}); err == nil {
+		t.Error("expected an error for a single item")
+	}
+}
@@ -0,0 +1,276 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package responder
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"ssltool/pkg/ca"
+	"ssltool/pkg/revocation"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// DefaultValidity is how long responses are valid when Responder.Validity
+// is zero.
+const DefaultValidity = time.Hour
+
+// maxRequestSize bounds POST bodies; real requests are a few hundred bytes.
+const maxRequestSize = 10000
+
+// Status is what a Source knows about a serial number.
+type Status struct {
+	Status           int
+	RevokedAt        time.Time
+	RevocationReason int
+	// NextUpdate, if set, caps the NextUpdate of the response, e.g. at
+	// that of the CRL the status came from.
+	NextUpdate time.Time
+}
+
+// Source looks up certificates issued by the responder's issuer.
+type Source interface {
+	Lookup(serial *big.Int) (Status, error)
+}
+
+// Responder answers OCSP requests over HTTP for the certificates of one
+// issuer, in both the GET and the POST form of RFC 6960 appendix A.
+type Responder struct {
+	Issuer *x509.Certificate
+	// Cert and Key sign the responses. Cert is either the issuer itself or
+	// a delegated responder certificate issued by it.
+	Cert     *x509.Certificate
+	Key      crypto.Signer
+	Source   Source
+	Validity time.Duration
+	// Now is used instead of time.Now if set.
+	Now func() time.Time
+}
+
+// New checks that cert may sign responses for issuer and returns a Responder.
+func New(issuer, cert *x509.Certificate, key crypto.Signer, source Source) (*Responder, error) {
+	if !publicKeysEqual(key.Public(), cert.PublicKey) {
+		return nil, errors.New("the responder key does not match the responder certificate")
+	}
+	if !cert.Equal(issuer) {
+		if err := cert.CheckSignatureFrom(issuer); err != nil {
+			return nil, fmt.Errorf("the responder certificate was not issued by %s: %w", issuer.Subject, err)
+		}
+		ocspSigning := false
+		for _, usage := range cert.ExtKeyUsage {
+			ocspSigning = ocspSigning || usage == x509.ExtKeyUsageOCSPSigning
+		}
+		if !ocspSigning {
+			return nil, errors.New("the responder certificate lacks the OCSP signing extended key usage")
+		}
+	}
+	return &Responder{Issuer: issuer, Cert: cert, Key: key, Source: source}, nil
+}
+
+func (r *Responder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var der []byte
+	var err error
+	switch req.Method {
+	case http.MethodGet:
+		der, err = decodeGetRequest(req.URL.EscapedPath())
+	case http.MethodPost:
+		der, err = io.ReadAll(io.LimitReader(req.Body, maxRequestSize))
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		r.write(w, ocsp.MalformedRequestErrorResponse)
+		return
+	}
+	ocspReq, err := ocsp.ParseRequest(der)
+	if err != nil {
+		r.write(w, ocsp.MalformedRequestErrorResponse)
+		return
+	}
+	resp, err := r.Respond(ocspReq)
+	if err != nil {
+		log.Printf("ocsp: serial %x: %s", ocspReq.SerialNumber, err.Error())
+		r.write(w, ocsp.InternalErrorErrorResponse)
+		return
+	}
+	r.write(w, resp)
+}
+
+// Respond returns the signed response to req, or an unauthorized response
+// if req is for a different issuer.
+func (r *Responder) Respond(req *ocsp.Request) ([]byte, error) {
+	if !r.issuedBy(req) {
+		return ocsp.UnauthorizedErrorResponse, nil
+	}
+	status, err := r.Source.Lookup(req.SerialNumber)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if r.Now != nil {
+		now = r.Now()
+	}
+	validity := r.Validity
+	if validity <= 0 {
+		validity = DefaultValidity
+	}
+	template := ocsp.Response{
+		Status:       status.Status,
+		SerialNumber: req.SerialNumber,
+		ThisUpdate:   now.UTC().Truncate(time.Second),
+		NextUpdate:   now.UTC().Truncate(time.Second).Add(validity),
+		IssuerHash:   req.HashAlgorithm,
+	}
+	if !status.NextUpdate.IsZero() && status.NextUpdate.Before(template.NextUpdate) {
+		template.NextUpdate = status.NextUpdate
+	}
+	if status.Status == ocsp.Revoked {
+		template.RevokedAt = status.RevokedAt
+		template.RevocationReason = status.RevocationReason
+	}
+	if !r.Cert.Equal(r.Issuer) {
+		template.Certificate = r.Cert
+	}
+	return ocsp.CreateResponse(r.Issuer, r.Cert, template, r.Key)
+}
+
+func (r *Responder) write(w http.ResponseWriter, resp []byte) {
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	w.Write(resp)
+}
+
+// issuedBy compares the issuer name and key hashes of req with the issuer.
+func (r *Responder) issuedBy(req *ocsp.Request) bool {
+	if !req.HashAlgorithm.Available() {
+		return false
+	}
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(r.Issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return false
+	}
+	h := req.HashAlgorithm.New()
+	h.Write(r.Issuer.RawSubject)
+	nameHash := h.Sum(nil)
+	h.Reset()
+	h.Write(spki.PublicKey.RightAlign())
+	keyHash := h.Sum(nil)
+	return bytes.Equal(nameHash, req.IssuerNameHash) && bytes.Equal(keyHash, req.IssuerKeyHash)
+}
+
+// decodeGetRequest decodes the base64 request that makes up the escaped
+// path. Clients don't always escape it, so '+' is kept as is. Use
+// http.StripPrefix to serve below the root.
+func decodeGetRequest(path string) ([]byte, error) {
+	encoded := strings.TrimPrefix(path, "/")
+	encoded, err := url.PathUnescape(strings.ReplaceAll(encoded, "+", "%2B"))
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+// IndexSource answers from an index file written by ssltool ca. The file is
+// read again whenever it changes, so revocations show up without a restart.
+// Serials missing from the index are unknown.
+type IndexSource struct {
+	Path    string
+	mu      sync.Mutex
+	modTime time.Time
+	index   *ca.Index
+}
+
+func (s *IndexSource) Lookup(serial *big.Int) (Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, err := os.Stat(s.Path)
+	if err != nil {
+		return Status{}, err
+	}
+	if s.index == nil || !info.ModTime().Equal(s.modTime) {
+		index, err := ca.ReadIndex(s.Path)
+		if err != nil {
+			return Status{}, err
+		}
+		s.index, s.modTime = index, info.ModTime()
+	}
+	entry := s.index.Find(ca.FormatSerial(serial))
+	if entry == nil {
+		return Status{Status: ocsp.Unknown}, nil
+	}
+	if entry.RevokedAt == nil {
+		return Status{Status: ocsp.Good}, nil
+	}
+	reason, _ := revocation.ReasonCode(entry.Reason)
+	return Status{Status: ocsp.Revoked, RevokedAt: *entry.RevokedAt, RevocationReason: reason}, nil
+}
+
+// CRLSource answers from a CRL file signed by Issuer, read again whenever it
+// changes. A CRL only lists revoked serials, so every other serial is good.
+// Lookups fail once the CRL is past its NextUpdate, and responses are never
+// valid beyond it.
+type CRLSource struct {
+	Path    string
+	Issuer  *x509.Certificate
+	mu      sync.Mutex
+	modTime time.Time
+	crl     *x509.RevocationList
+}
+
+func (s *CRLSource) Lookup(serial *big.Int) (Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, err := os.Stat(s.Path)
+	if err != nil {
+		return Status{}, err
+	}
+	if s.crl == nil || !info.ModTime().Equal(s.modTime) {
+		data, err := os.ReadFile(s.Path)
+		if err != nil {
+			return Status{}, err
+		}
+		crl, err := revocation.ParseCRL(data)
+		if err != nil {
+			return Status{}, err
+		}
+		if err := crl.CheckSignatureFrom(s.Issuer); err != nil {
+			return Status{}, fmt.Errorf("CRL not signed by %s: %w", s.Issuer.Subject, err)
+		}
+		s.crl, s.modTime = crl, info.ModTime()
+	}
+	nextUpdate := s.crl.NextUpdate
+	if !nextUpdate.IsZero() && time.Now().After(nextUpdate) {
+		return Status{}, fmt.Errorf("CRL expired at %s", nextUpdate.Format(time.RFC3339))
+	}
+	for _, entry := range s.crl.RevokedCertificateEntries {
+		if entry.SerialNumber.Cmp(serial) == 0 {
+			return Status{Status: ocsp.Revoked, RevokedAt: entry.RevocationTime, RevocationReason: entry.ReasonCode, NextUpdate: nextUpdate}, nil
+		}
+	}
+	return Status{Status: ocsp.Good, NextUpdate: nextUpdate}, nil
+}
+
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
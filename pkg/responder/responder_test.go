@@ -0,0 +1,311 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package responder
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"ssltool/pkg/ca"
+	"ssltool/pkg/gen"
+	"ssltool/pkg/revocation"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+type testSetup struct {
+	ca        *ca.CA
+	server    *httptest.Server
+	responder *Responder
+	good      *x509.Certificate
+	revoked   *x509.Certificate
+}
+
+// newTestSetup creates a CA with a delegated responder served over HTTP, a
+// good and a revoked certificate that point at it.
+func newTestSetup(t *testing.T) testSetup {
+	t.Helper()
+	var handler http.Handler
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	authority, err := ca.Init(t.TempDir(), ca.InitOptions{
+		Subject:          pkix.Name{CommonName: "Test Root"},
+		IntermediateName: "Test Issuing CA",
+		Days:             ca.DefaultCADays,
+		Config:           ca.Config{OCSPURLs: []string{server.URL}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create CA: %v", err)
+	}
+	responderKey := newKey(t)
+	responderCert, _, err := authority.Issue(gen.CsrInputInfo{CommonName: "OCSP Responder", PrivKey: responderKey}, ca.ProfileOCSPSigning, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	good := issue(t, authority, "good.example.com")
+	revoked := issue(t, authority, "revoked.example.com")
+	if _, err := authority.Revoke(ca.FormatSerial(revoked.SerialNumber), "keyCompromise", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	responder, err := New(authority.Issuer(), responderCert, responderKey, &IndexSource{Path: filepath.Join(authority.Dir, ca.IndexFile)})
+	if err != nil {
+		t.Fatalf("failed to create responder: %v", err)
+	}
+	handler = responder
+	return testSetup{ca: authority, server: server, responder: responder, good: good, revoked: revoked}
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	return key
+}
+
+func issue(t *testing.T, authority *ca.CA, cn string) *x509.Certificate {
+	t.Helper()
+	cert, _, err := authority.Issue(gen.CsrInputInfo{CommonName: cn, PrivKey: newKey(t)}, ca.ProfileServer, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestResponder_POST(t *testing.T) {
+	setup := newTestSetup(t)
+	issuer := setup.ca.Issuer()
+
+	// CheckOCSP posts to the responder in the certificate and verifies the
+	// delegated signature
+	status := revocation.CheckOCSP(context.Background(), http.DefaultClient, setup.good, issuer, nil, time.Now())
+	if status.Status != revocation.StatusGood {
+		t.Errorf("expected good status, got %+v", status)
+	}
+	status = revocation.CheckOCSP(context.Background(), http.DefaultClient, setup.revoked, issuer, nil, time.Now())
+	if status.Status != revocation.StatusRevoked || status.Reason != "keyCompromise" {
+		t.Errorf("expected revoked status, got %+v", status)
+	}
+}
+
+func TestResponder_GET(t *testing.T) {
+	setup := newTestSetup(t)
+	issuer := setup.ca.Issuer()
+
+	for _, hash := range []crypto.Hash{crypto.SHA1, crypto.SHA256} {
+		req, err := ocsp.CreateRequest(setup.revoked, issuer, &ocsp.RequestOptions{Hash: hash})
+		if err != nil {
+			t.Fatal(err)
+		}
+		httpResp, err := http.Get(setup.server.URL + "/" + url.PathEscape(base64.StdEncoding.EncodeToString(req)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(httpResp.Body)
+		httpResp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if httpResp.Header.Get("Content-Type") != "application/ocsp-response" {
+			t.Errorf("unexpected content type %q", httpResp.Header.Get("Content-Type"))
+		}
+		resp, err := ocsp.ParseResponseForCert(body, setup.revoked, issuer)
+		if err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		if resp.Status != ocsp.Revoked || resp.RevocationReason != ocsp.KeyCompromise {
+			t.Errorf("expected revoked status with %s, got %d", hash, resp.Status)
+		}
+	}
+}
+
+func TestResponder_Errors(t *testing.T) {
+	setup := newTestSetup(t)
+	issuer := setup.ca.Issuer()
+
+	// a serial the CA never issued
+	unknown := *setup.good
+	unknown.SerialNumber = big.NewInt(42)
+	req, err := ocsp.CreateRequest(&unknown, issuer, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ocsp.ParseRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := setup.responder.Respond(parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := ocsp.ParseResponse(der, issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != ocsp.Unknown {
+		t.Errorf("expected unknown status, got %d", resp.Status)
+	}
+
+	// a certificate from a different issuer
+	req, err = ocsp.CreateRequest(setup.good, setup.ca.Root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err = ocsp.ParseRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err = setup.responder.Respond(parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ocsp.ParseResponse(der, issuer); !isResponseError(err, ocsp.Unauthorized) {
+		t.Errorf("expected unauthorized, got %v", err)
+	}
+
+	httpResp, err := http.Post(setup.server.URL, "application/ocsp-request", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(httpResp.Body)
+	httpResp.Body.Close()
+	if _, err := ocsp.ParseResponse(body, issuer); !isResponseError(err, ocsp.Malformed) {
+		t.Errorf("expected malformed, got %v", err)
+	}
+}
+
+func isResponseError(err error, status ocsp.ResponseStatus) bool {
+	var respErr ocsp.ResponseError
+	return errors.As(err, &respErr) && respErr.Status == status
+}
+
+func TestIndexSource_Reload(t *testing.T) {
+	setup := newTestSetup(t)
+	source := setup.responder.Source
+	status, err := source.Lookup(setup.good.SerialNumber)
+	if err != nil || status.Status != ocsp.Good {
+		t.Fatalf("expected good status, got %+v, %v", status, err)
+	}
+	// make sure the modification time changes on coarse file systems
+	time.Sleep(10 * time.Millisecond)
+	if _, err := setup.ca.Revoke(ca.FormatSerial(setup.good.SerialNumber), "superseded", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	status, err = source.Lookup(setup.good.SerialNumber)
+	if err != nil || status.Status != ocsp.Revoked || status.RevocationReason != ocsp.Superseded {
+		t.Errorf("expected the revocation after reload, got %+v, %v", status, err)
+	}
+}
+
+func TestCRLSource(t *testing.T) {
+	setup := newTestSetup(t)
+	crl, err := setup.ca.CRL(time.Now(), ca.DefaultCRLDays)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "ca.crl")
+	if err := os.WriteFile(path, crl.Raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	source := &CRLSource{Path: path, Issuer: setup.ca.Issuer()}
+	status, err := source.Lookup(setup.revoked.SerialNumber)
+	if err != nil || status.Status != ocsp.Revoked || status.RevocationReason != ocsp.KeyCompromise {
+		t.Errorf("expected revoked status, got %+v, %v", status, err)
+	}
+	status, err = source.Lookup(setup.good.SerialNumber)
+	if err != nil || status.Status != ocsp.Good {
+		t.Errorf("expected good status, got %+v, %v", status, err)
+	}
+
+	source = &CRLSource{Path: path, Issuer: setup.ca.Root}
+	if _, err := source.Lookup(setup.good.SerialNumber); err == nil {
+		t.Error("expected an error for a CRL from a different issuer")
+	}
+}
+
+func TestCRLSource_NextUpdate(t *testing.T) {
+	setup := newTestSetup(t)
+	path := filepath.Join(t.TempDir(), "ca.crl")
+	writeCRL := func(now time.Time) *x509.RevocationList {
+		t.Helper()
+		crl, err := setup.ca.CRL(now, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, crl.Raw, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return crl
+	}
+
+	crl := writeCRL(time.Now())
+	setup.responder.Source = &CRLSource{Path: path, Issuer: setup.ca.Issuer()}
+	setup.responder.Validity = 30 * 24 * time.Hour
+	raw, err := ocsp.CreateRequest(setup.good, setup.ca.Issuer(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := ocsp.ParseRequest(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := setup.responder.Respond(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := ocsp.ParseResponse(der, setup.ca.Issuer())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.NextUpdate.Equal(crl.NextUpdate) {
+		t.Errorf("expected NextUpdate capped at %s, got %s", crl.NextUpdate, resp.NextUpdate)
+	}
+
+	// make sure the modification time changes on coarse file systems
+	time.Sleep(10 * time.Millisecond)
+	writeCRL(time.Now().Add(-48 * time.Hour))
+	if _, err := setup.responder.Respond(req); err == nil {
+		t.Error("expected an error for an expired CRL")
+	}
+}
+
+func TestNew_RequiresOCSPSigning(t *testing.T) {
+	authority, err := ca.Init(t.TempDir(), ca.InitOptions{Subject: pkix.Name{CommonName: "Test Root"}, Days: ca.DefaultCADays})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := newKey(t)
+	server, _, err := authority.Issue(gen.CsrInputInfo{CommonName: "www.example.com", PrivKey: key}, ca.ProfileServer, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := &IndexSource{Path: filepath.Join(authority.Dir, ca.IndexFile)}
+	if _, err := New(authority.Issuer(), server, key, source); err == nil {
+		t.Error("expected an error for a certificate without OCSP signing")
+	}
+	if _, err := New(authority.Issuer(), server, newKey(t), source); err == nil {
+		t.Error("expected an error for a mismatched key")
+	}
+}
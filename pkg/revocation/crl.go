@@ -0,0 +1,214 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package revocation
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultCacheDir is where downloaded CRLs are kept between runs.
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ssltool", "crl"), nil
+}
+
+// ParseCRL parses a DER or PEM encoded CRL.
+func ParseCRL(data []byte) (*x509.RevocationList, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != "X509 CRL" {
+			return nil, fmt.Errorf("unexpected PEM block %q", block.Type)
+		}
+		data = block.Bytes
+	}
+	return x509.ParseRevocationList(data)
+}
+
+// FetchCRL loads a CRL from an http(s) or file URL. HTTP downloads are cached
+// in cacheDir, if set, and reused until their nextUpdate has passed.
+func FetchCRL(ctx context.Context, client *http.Client, crlURL, cacheDir string, now time.Time) (*x509.RevocationList, error) {
+	u, err := url.Parse(crlURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "file":
+		data, err := os.ReadFile(u.Path)
+		if err != nil {
+			return nil, err
+		}
+		return ParseCRL(data)
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("unsupported CRL URL scheme %q", u.Scheme)
+	}
+
+	var cacheFile string
+	if cacheDir != "" {
+		sum := sha256.Sum256([]byte(crlURL))
+		cacheFile = filepath.Join(cacheDir, hex.EncodeToString(sum[:])+".crl")
+		if data, err := os.ReadFile(cacheFile); err == nil {
+			crl, err := ParseCRL(data)
+			if err == nil && !crl.NextUpdate.IsZero() && crl.NextUpdate.After(now) {
+				return crl, nil
+			}
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, crlURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if err != nil {
+		return nil, err
+	}
+	crl, err := ParseCRL(data)
+	if err != nil {
+		return nil, err
+	}
+	if cacheFile != "" {
+		if err := os.MkdirAll(cacheDir, 0700); err == nil {
+			_ = os.WriteFile(cacheFile, crl.Raw, 0600)
+		}
+	}
+	return crl, nil
+}
+
+// CheckCRLChain checks every certificate in chain (leaf first) like
+// CheckOCSPChain.
+func CheckCRLChain(ctx context.Context, client *http.Client, chain []*x509.Certificate, cacheDir string, now time.Time) []Status {
+	var statuses []Status
+	for _, pair := range issuerPairs(chain) {
+		if pair[1] == nil {
+			statuses = append(statuses, issuerUnavailable(pair[0], "crl"))
+			continue
+		}
+		statuses = append(statuses, CheckCRL(ctx, client, pair[0], pair[1], cacheDir, now))
+	}
+	return statuses
+}
+
+// CheckCRL looks the certificate up in the CRLs from its distribution
+// points, verifying each CRL was signed by issuer and is current.
+func CheckCRL(ctx context.Context, client *http.Client, cert, issuer *x509.Certificate, cacheDir string, now time.Time) Status {
+	status := Status{Subject: cert.Subject.String(), Method: "crl", Status: StatusError}
+	if len(cert.CRLDistributionPoints) == 0 {
+		status.Error = "certificate has no CRL distribution points"
+		return status
+	}
+	var errs []error
+	for _, point := range cert.CRLDistributionPoints {
+		crl, err := FetchCRL(ctx, client, point, cacheDir, now)
+		if err == nil {
+			err = validateCRL(crl, issuer, now)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", point, err))
+			continue
+		}
+		status.Source = point
+		status.Status = StatusGood
+		status.ThisUpdate = crl.ThisUpdate
+		status.NextUpdate = crl.NextUpdate
+		for _, entry := range crl.RevokedCertificateEntries {
+			if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				status.Status = StatusRevoked
+				revokedAt := entry.RevocationTime
+				status.RevokedAt = &revokedAt
+				status.Reason = ReasonName(entry.ReasonCode)
+				break
+			}
+		}
+		return status
+	}
+	status.Error = errors.Join(errs...).Error()
+	return status
+}
+
+func validateCRL(crl *x509.RevocationList, issuer *x509.Certificate, now time.Time) error {
+	if !bytes.Equal(crl.RawIssuer, issuer.RawSubject) {
+		return fmt.Errorf("CRL issuer %s does not match %s", crl.Issuer, issuer.Subject)
+	}
+	if err := crl.CheckSignatureFrom(issuer); err != nil {
+		return fmt.Errorf("invalid CRL signature: %w", err)
+	}
+	if crl.ThisUpdate.After(now.Add(maxClockSkew)) {
+		return fmt.Errorf("CRL is not yet valid (thisUpdate %s)", crl.ThisUpdate.Format(time.RFC3339))
+	}
+	if !crl.NextUpdate.IsZero() && crl.NextUpdate.Before(now.Add(-maxClockSkew)) {
+		return fmt.Errorf("CRL is stale (nextUpdate %s)", crl.NextUpdate.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// IsURL reports whether s looks like a CRL URL rather than a file path.
+func IsURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "file://")
+}
+
+// CRLInfo is the printable form of a CRL.
+type CRLInfo struct {
+	Issuer             string     `json:"issuer" yaml:"issuer"`
+	Number             string     `json:"number,omitempty" yaml:"number,omitempty"`
+	ThisUpdate         time.Time  `json:"this_update" yaml:"this_update"`
+	NextUpdate         time.Time  `json:"next_update,omitempty" yaml:"next_update,omitempty"`
+	SignatureAlgorithm string     `json:"signature_algorithm" yaml:"signature_algorithm"`
+	Entries            []CRLEntry `json:"entries" yaml:"entries"`
+}
+
+type CRLEntry struct {
+	Serial    string    `json:"serial" yaml:"serial"`
+	RevokedAt time.Time `json:"revoked_at" yaml:"revoked_at"`
+	Reason    string    `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+func NewCRLInfo(crl *x509.RevocationList) CRLInfo {
+	info := CRLInfo{
+		Issuer:             crl.Issuer.String(),
+		ThisUpdate:         crl.ThisUpdate.UTC(),
+		NextUpdate:         crl.NextUpdate.UTC(),
+		SignatureAlgorithm: crl.SignatureAlgorithm.String(),
+		Entries:            make([]CRLEntry, 0, len(crl.RevokedCertificateEntries)),
+	}
+	if crl.Number != nil {
+		info.Number = fmt.Sprintf("%x", crl.Number)
+	}
+	for _, entry := range crl.RevokedCertificateEntries {
+		crlEntry := CRLEntry{
+			Serial:    fmt.Sprintf("%x", entry.SerialNumber),
+			RevokedAt: entry.RevocationTime.UTC(),
+		}
+		// a reason code of 0 is also what Go reports when the extension is absent
+		if entry.ReasonCode != 0 {
+			crlEntry.Reason = ReasonName(entry.ReasonCode)
+		}
+		info.Entries = append(info.Entries, crlEntry)
+	}
+	return info
+}
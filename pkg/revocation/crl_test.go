@@ -0,0 +1,187 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package revocation
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"ssltool/pkg/internal/testcert"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestCRL(t *testing.T, issuer *testcert.Cert, nextUpdate time.Time, revoked ...*x509.Certificate) []byte {
+	t.Helper()
+	template := &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: nextUpdate.Add(-2 * time.Hour),
+		NextUpdate: nextUpdate,
+	}
+	for _, cert := range revoked {
+		template.RevokedCertificateEntries = append(template.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber:   cert.SerialNumber,
+			RevocationTime: time.Now().Add(-time.Hour).Truncate(time.Second),
+			ReasonCode:     1,
+		})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, template, issuer.Cert, issuer.Key)
+	if err != nil {
+		t.Fatalf("failed to create CRL: %v", err)
+	}
+	return der
+}
+
+// startCRLServer serves crl and counts the downloads.
+func startCRLServer(t *testing.T, crl []byte, hits *atomic.Int32) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/pkix-crl")
+		w.Write(crl)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCheckCRL(t *testing.T) {
+	ca := testcert.NewCA(t, "Test CA", nil)
+	revokedLeaf := newTestLeaf(t, ca, nil)
+	nextUpdate := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		signer func() *testcert.Cert
+		next   time.Time
+		leaf   func() *testcert.Cert
+		want   string
+	}{
+		{"good", func() *testcert.Cert { return ca }, nextUpdate, func() *testcert.Cert { return newTestLeaf(t, ca, nil) }, StatusGood},
+		{"revoked", func() *testcert.Cert { return ca }, nextUpdate, func() *testcert.Cert { return revokedLeaf }, StatusRevoked},
+		{"wrong signer", func() *testcert.Cert { return testcert.NewCA(t, "Test CA", nil) }, nextUpdate, func() *testcert.Cert { return newTestLeaf(t, ca, nil) }, StatusError},
+		{"stale", func() *testcert.Cert { return ca }, time.Now().Add(-time.Hour), func() *testcert.Cert { return newTestLeaf(t, ca, nil) }, StatusError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits atomic.Int32
+			server := startCRLServer(t, newTestCRL(t, tt.signer(), tt.next, revokedLeaf.Cert), &hits)
+			leaf := tt.leaf()
+			leaf.Cert.CRLDistributionPoints = []string{server.URL}
+
+			status := CheckCRL(context.Background(), server.Client(), leaf.Cert, ca.Cert, "", time.Now())
+			if status.Status != tt.want {
+				t.Fatalf("status mismatch; got %s, want %s (%s)", status.Status, tt.want, status.Error)
+			}
+			if status.Method != "crl" {
+				t.Errorf("method mismatch; got %q", status.Method)
+			}
+			if tt.want == StatusRevoked {
+				if status.RevokedAt == nil || status.Reason != "keyCompromise" {
+					t.Errorf("expected revocation time and reason, got %+v", status)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckCRL_NoDistributionPoints(t *testing.T) {
+	ca := testcert.NewCA(t, "Test CA", nil)
+	leaf := newTestLeaf(t, ca, nil)
+
+	status := CheckCRL(context.Background(), http.DefaultClient, leaf.Cert, ca.Cert, "", time.Now())
+	if status.Status != StatusError {
+		t.Errorf("expected error without distribution points, got %s", status.Status)
+	}
+}
+
+func TestFetchCRL_File(t *testing.T) {
+	ca := testcert.NewCA(t, "Test CA", nil)
+	leaf := newTestLeaf(t, ca, nil)
+	crl := newTestCRL(t, ca, time.Now().Add(time.Hour), leaf.Cert)
+	path := filepath.Join(t.TempDir(), "ca.crl")
+	data := pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	leaf.Cert.CRLDistributionPoints = []string{"file://" + path}
+
+	status := CheckCRL(context.Background(), http.DefaultClient, leaf.Cert, ca.Cert, "", time.Now())
+	if status.Status != StatusRevoked {
+		t.Errorf("status mismatch; got %s (%s)", status.Status, status.Error)
+	}
+}
+
+func TestFetchCRL_Cache(t *testing.T) {
+	ca := testcert.NewCA(t, "Test CA", nil)
+	var hits atomic.Int32
+	server := startCRLServer(t, newTestCRL(t, ca, time.Now().Add(time.Hour)), &hits)
+	cacheDir := t.TempDir()
+
+	for i := 0; i < 2; i++ {
+		if _, err := FetchCRL(context.Background(), server.Client(), server.URL, cacheDir, time.Now()); err != nil {
+			t.Fatalf("fetch failed: %v", err)
+		}
+	}
+	if hits.Load() != 1 {
+		t.Errorf("expected the second fetch to come from the cache, got %d downloads", hits.Load())
+	}
+
+	// once nextUpdate has passed the CRL is downloaded again
+	if _, err := FetchCRL(context.Background(), server.Client(), server.URL, cacheDir, time.Now().Add(2*time.Hour)); err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	if hits.Load() != 2 {
+		t.Errorf("expected an expired cache entry to be refreshed, got %d downloads", hits.Load())
+	}
+}
+
+func TestCheckCRLChain(t *testing.T) {
+	root := testcert.NewCA(t, "Root", nil)
+	intermediate := testcert.NewCA(t, "Intermediate", root)
+	leaf := newTestLeaf(t, intermediate, nil)
+	var rootHits, intermediateHits atomic.Int32
+	rootServer := startCRLServer(t, newTestCRL(t, root, time.Now().Add(time.Hour), intermediate.Cert), &rootHits)
+	intermediateServer := startCRLServer(t, newTestCRL(t, intermediate, time.Now().Add(time.Hour)), &intermediateHits)
+	intermediate.Cert.CRLDistributionPoints = []string{rootServer.URL}
+	leaf.Cert.CRLDistributionPoints = []string{intermediateServer.URL}
+
+	statuses := CheckCRLChain(context.Background(), http.DefaultClient, []*x509.Certificate{leaf.Cert, intermediate.Cert, root.Cert}, "", time.Now())
+	if len(statuses) != 2 {
+		t.Fatalf("expected statuses for leaf and intermediate, got %d", len(statuses))
+	}
+	if statuses[0].Status != StatusGood {
+		t.Errorf("leaf status mismatch; got %s (%s)", statuses[0].Status, statuses[0].Error)
+	}
+	if statuses[1].Status != StatusRevoked {
+		t.Errorf("intermediate status mismatch; got %s (%s)", statuses[1].Status, statuses[1].Error)
+	}
+}
+
+func TestNewCRLInfo(t *testing.T) {
+	ca := testcert.NewCA(t, "Test CA", nil)
+	leaf := newTestLeaf(t, ca, nil)
+	crl, err := ParseCRL(newTestCRL(t, ca, time.Now().Add(time.Hour), leaf.Cert))
+	if err != nil {
+		t.Fatalf("failed to parse CRL: %v", err)
+	}
+
+	info := NewCRLInfo(crl)
+	if info.Issuer != "CN=Test CA" || info.Number != "1" {
+		t.Errorf("unexpected issuer or number: %+v", info)
+	}
+	if len(info.Entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(info.Entries))
+	}
+	if info.Entries[0].Serial != fmt.Sprintf("%x", leaf.Cert.SerialNumber) || info.Entries[0].Reason != "keyCompromise" {
+		t.Errorf("unexpected entry: %+v", info.Entries[0])
+	}
+}
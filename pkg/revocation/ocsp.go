@@ -0,0 +1,138 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package revocation
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// CheckOCSPChain checks every certificate in chain (leaf first) except a
+// self-signed root. chain should reach the root, e.g. a verified chain;
+// certificates whose issuer is not in it get an error status. The stapled
+// response, if any, is used for the leaf instead of querying its responder.
+func CheckOCSPChain(ctx context.Context, client *http.Client, chain []*x509.Certificate, stapled []byte, now time.Time) []Status {
+	var statuses []Status
+	for _, pair := range issuerPairs(chain) {
+		if pair[1] == nil {
+			statuses = append(statuses, issuerUnavailable(pair[0], "ocsp"))
+			continue
+		}
+		var staple []byte
+		if pair[0] == chain[0] {
+			staple = stapled
+		}
+		statuses = append(statuses, CheckOCSP(ctx, client, pair[0], pair[1], staple, now))
+	}
+	return statuses
+}
+
+// CheckOCSP uses the stapled response when it is present and valid and
+// otherwise asks the responders listed in the certificate's AIA extension.
+func CheckOCSP(ctx context.Context, client *http.Client, cert, issuer *x509.Certificate, stapled []byte, now time.Time) Status {
+	status := Status{Subject: cert.Subject.String(), Method: "ocsp", Status: StatusError}
+	var errs []error
+	if len(stapled) > 0 {
+		resp, err := parseOCSP(stapled, cert, issuer, now)
+		if err == nil {
+			return ocspStatus(status, "stapled", resp)
+		}
+		errs = append(errs, fmt.Errorf("stapled: %w", err))
+	}
+	if len(cert.OCSPServer) == 0 && len(errs) == 0 {
+		status.Error = "certificate has no OCSP responder"
+		return status
+	}
+	request, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	for _, server := range cert.OCSPServer {
+		raw, err := queryOCSP(ctx, client, server, request)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", server, err))
+			continue
+		}
+		resp, err := parseOCSP(raw, cert, issuer, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", server, err))
+			continue
+		}
+		return ocspStatus(status, server, resp)
+	}
+	status.Error = errors.Join(errs...).Error()
+	return status
+}
+
+func ocspStatus(status Status, source string, resp *ocsp.Response) Status {
+	status.Source = source
+	status.ThisUpdate = resp.ThisUpdate
+	status.NextUpdate = resp.NextUpdate
+	switch resp.Status {
+	case ocsp.Good:
+		status.Status = StatusGood
+	case ocsp.Revoked:
+		status.Status = StatusRevoked
+		revokedAt := resp.RevokedAt
+		status.RevokedAt = &revokedAt
+		status.Reason = ReasonName(resp.RevocationReason)
+	default:
+		status.Status = StatusUnknown
+	}
+	return status
+}
+
+func queryOCSP(ctx context.Context, client *http.Client, server string, request []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server, bytes.NewReader(request))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	req.Header.Set("Accept", "application/ocsp-response")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// parseOCSP verifies the response signature, that a delegated responder is
+// authorized by the issuer, and that the response is current.
+func parseOCSP(raw []byte, cert, issuer *x509.Certificate, now time.Time) (*ocsp.Response, error) {
+	resp, err := ocsp.ParseResponseForCert(raw, cert, issuer)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Certificate != nil && !resp.Certificate.Equal(issuer) {
+		authorized := false
+		for _, usage := range resp.Certificate.ExtKeyUsage {
+			if usage == x509.ExtKeyUsageOCSPSigning {
+				authorized = true
+			}
+		}
+		if !authorized {
+			return nil, errors.New("responder certificate is not authorized for OCSP signing")
+		}
+	}
+	if resp.ThisUpdate.After(now.Add(maxClockSkew)) {
+		return nil, fmt.Errorf("response is not yet valid (thisUpdate %s)", resp.ThisUpdate.Format(time.RFC3339))
+	}
+	if !resp.NextUpdate.IsZero() && resp.NextUpdate.Before(now.Add(-maxClockSkew)) {
+		return nil, fmt.Errorf("response is stale (nextUpdate %s)", resp.NextUpdate.Format(time.RFC3339))
+	}
+	return resp, nil
+}
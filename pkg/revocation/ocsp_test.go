@@ -0,0 +1,172 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package revocation
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"ssltool/pkg/internal/testcert"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// startOCSPResponder answers every request for issuer with the given status,
+// signed by signer (the issuer itself or a delegated responder).
+func startOCSPResponder(t *testing.T, issuer, signer *testcert.Cert, status int, nextUpdate time.Time) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req, err := ocsp.ParseRequest(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		template := ocsp.Response{
+			Status:       status,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   nextUpdate,
+		}
+		if status == ocsp.Revoked {
+			template.RevokedAt = time.Now().Add(-time.Hour).Truncate(time.Second)
+			template.RevocationReason = ocsp.KeyCompromise
+		}
+		if signer != issuer {
+			template.Certificate = signer.Cert
+		}
+		resp, err := ocsp.CreateResponse(issuer.Cert, signer.Cert, template, signer.Key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		w.Write(resp)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newDelegatedResponder(t *testing.T, issuer *testcert.Cert, ocspSigning bool) *testcert.Cert {
+	template := &x509.Certificate{Subject: pkix.Name{CommonName: "OCSP Responder"}}
+	if ocspSigning {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning}
+	}
+	return testcert.Issue(t, template, issuer)
+}
+
+func TestCheckOCSP_Responder(t *testing.T) {
+	ca := testcert.NewCA(t, "Test CA", nil)
+	nextUpdate := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		signer func() *testcert.Cert
+		status int
+		want   string
+	}{
+		{"good", func() *testcert.Cert { return ca }, ocsp.Good, StatusGood},
+		{"revoked", func() *testcert.Cert { return ca }, ocsp.Revoked, StatusRevoked},
+		{"unknown", func() *testcert.Cert { return ca }, ocsp.Unknown, StatusUnknown},
+		{"delegated", func() *testcert.Cert { return newDelegatedResponder(t, ca, true) }, ocsp.Good, StatusGood},
+		{"unauthorized delegate", func() *testcert.Cert { return newDelegatedResponder(t, ca, false) }, ocsp.Good, StatusError},
+		{"wrong signer", func() *testcert.Cert { return testcert.NewCA(t, "Other CA", nil) }, ocsp.Good, StatusError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startOCSPResponder(t, ca, tt.signer(), tt.status, nextUpdate)
+			leaf := newTestLeaf(t, ca, func(c *x509.Certificate) { c.OCSPServer = []string{server.URL} })
+
+			status := CheckOCSP(context.Background(), server.Client(), leaf.Cert, ca.Cert, nil, time.Now())
+			if status.Status != tt.want {
+				t.Fatalf("status mismatch; got %s, want %s (%s)", status.Status, tt.want, status.Error)
+			}
+			if tt.want == StatusRevoked {
+				if status.RevokedAt == nil || status.Reason != "keyCompromise" {
+					t.Errorf("expected revocation time and reason, got %+v", status)
+				}
+			}
+			if tt.want != StatusError && status.Source != server.URL {
+				t.Errorf("source mismatch; got %q, want %q", status.Source, server.URL)
+			}
+		})
+	}
+}
+
+func TestCheckOCSP_Stale(t *testing.T) {
+	ca := testcert.NewCA(t, "Test CA", nil)
+	server := startOCSPResponder(t, ca, ca, ocsp.Good, time.Now().Add(-time.Hour))
+	leaf := newTestLeaf(t, ca, func(c *x509.Certificate) { c.OCSPServer = []string{server.URL} })
+
+	status := CheckOCSP(context.Background(), server.Client(), leaf.Cert, ca.Cert, nil, time.Now())
+	if status.Status != StatusError {
+		t.Errorf("expected stale response to be rejected, got %s", status.Status)
+	}
+}
+
+func TestCheckOCSP_Stapled(t *testing.T) {
+	ca := testcert.NewCA(t, "Test CA", nil)
+	leaf := newTestLeaf(t, ca, nil)
+	stapled, err := ocsp.CreateResponse(ca.Cert, ca.Cert, ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: leaf.Cert.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   time.Now().Add(time.Hour),
+	}, ca.Key)
+	if err != nil {
+		t.Fatalf("failed to create response: %v", err)
+	}
+
+	// no responder is configured, so this only succeeds from the staple
+	status := CheckOCSP(context.Background(), http.DefaultClient, leaf.Cert, ca.Cert, stapled, time.Now())
+	if status.Status != StatusGood || status.Source != "stapled" {
+		t.Errorf("expected good stapled status, got %+v", status)
+	}
+
+	status = CheckOCSP(context.Background(), http.DefaultClient, leaf.Cert, ca.Cert, nil, time.Now())
+	if status.Status != StatusError {
+		t.Errorf("expected error without staple or responder, got %+v", status)
+	}
+}
+
+func TestCheckOCSPChain(t *testing.T) {
+	root := testcert.NewCA(t, "Root", nil)
+	rootResponder := startOCSPResponder(t, root, root, ocsp.Revoked, time.Now().Add(time.Hour))
+	intermediate := testcert.Issue(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Intermediate"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		OCSPServer:            []string{rootResponder.URL},
+	}, root)
+	intermediateResponder := startOCSPResponder(t, intermediate, intermediate, ocsp.Good, time.Now().Add(time.Hour))
+	leaf := newTestLeaf(t, intermediate, func(c *x509.Certificate) { c.OCSPServer = []string{intermediateResponder.URL} })
+
+	statuses := CheckOCSPChain(context.Background(), http.DefaultClient, []*x509.Certificate{leaf.Cert, intermediate.Cert, root.Cert}, nil, time.Now())
+	if len(statuses) != 2 {
+		t.Fatalf("expected statuses for leaf and intermediate, got %d", len(statuses))
+	}
+	if statuses[0].Status != StatusGood {
+		t.Errorf("leaf status mismatch; got %s (%s)", statuses[0].Status, statuses[0].Error)
+	}
+	if statuses[1].Status != StatusRevoked {
+		t.Errorf("intermediate status mismatch; got %s (%s)", statuses[1].Status, statuses[1].Error)
+	}
+
+	// a leaf served without its issuer is reported instead of skipped
+	statuses = CheckOCSPChain(context.Background(), http.DefaultClient, []*x509.Certificate{leaf.Cert}, nil, time.Now())
+	if len(statuses) != 1 || statuses[0].Status != StatusError || !strings.Contains(statuses[0].Error, "issuer unavailable") {
+		t.Errorf("expected an issuer unavailable error, got %+v", statuses)
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package revocation
+
+import (
+	"bytes"
+	"crypto/x509"
+	"time"
+)
+
+const (
+	StatusGood    = "good"
+	StatusRevoked = "revoked"
+	StatusUnknown = "unknown"
+	// StatusError means no usable answer could be obtained.
+	StatusError = "error"
+)
+
+// maxClockSkew is the tolerance applied to thisUpdate and nextUpdate.
+const maxClockSkew = 5 * time.Minute
+
+// Status is the revocation status of one certificate.
+type Status struct {
+	Subject string `json:"subject" yaml:"subject"`
+	Method  string `json:"method" yaml:"method"`
+	// Source is "stapled" or the URL the answer came from.
+	Source     string     `json:"source,omitempty" yaml:"source,omitempty"`
+	Status     string     `json:"status" yaml:"status"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" yaml:"revoked_at,omitempty"`
+	Reason     string     `json:"reason,omitempty" yaml:"reason,omitempty"`
+	ThisUpdate time.Time  `json:"this_update,omitempty" yaml:"this_update,omitempty"`
+	NextUpdate time.Time  `json:"next_update,omitempty" yaml:"next_update,omitempty"`
+	Error      string     `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+var reasonNames = map[int]string{
+	0:  "unspecified",
+	1:  "keyCompromise",
+	2:  "cACompromise",
+	3:  "affiliationChanged",
+	4:  "superseded",
+	5:  "cessationOfOperation",
+	6:  "certificateHold",
+	8:  "removeFromCRL",
+	9:  "privilegeWithdrawn",
+	10: "aACompromise",
+}
+
+// ReasonName returns the RFC 5280 name of a CRLReason code.
+func ReasonName(code int) string {
+	if name, ok := reasonNames[code]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ReasonCode is the inverse of ReasonName.
+func ReasonCode(name string) (int, bool) {
+	for code, n := range reasonNames {
+		if n == name {
+			return code, true
+		}
+	}
+	return 0, false
+}
+
+// issuerPairs pairs each certificate in chain (leaf first) with the
+// certificate in chain that signed it, or with nil when its issuer is not
+// in chain. Self-signed roots are skipped.
+func issuerPairs(chain []*x509.Certificate) [][2]*x509.Certificate {
+	var pairs [][2]*x509.Certificate
+	for _, cert := range chain {
+		if bytes.Equal(cert.RawSubject, cert.RawIssuer) {
+			continue
+		}
+		pair := [2]*x509.Certificate{cert, nil}
+		for _, candidate := range chain {
+			if candidate != cert && cert.CheckSignatureFrom(candidate) == nil {
+				pair[1] = candidate
+				break
+			}
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs
+}
+
+// issuerUnavailable is the status of a certificate whose issuer is unknown,
+// so its revocation can't be checked.
+func issuerUnavailable(cert *x509.Certificate, method string) Status {
+	return Status{
+		Subject: cert.Subject.String(),
+		Method:  method,
+		Status:  StatusError,
+		Error:   "issuer unavailable: " + cert.Issuer.String(),
+	}
+}
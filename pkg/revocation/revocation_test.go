@@ -0,0 +1,53 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package revocation
+
+import (
+	"crypto/x509"
+	"ssltool/pkg/internal/testcert"
+	"testing"
+)
+
+func newTestLeaf(t *testing.T, issuer *testcert.Cert, customize func(*x509.Certificate)) *testcert.Cert {
+	template := testcert.LeafTemplate("www.example.com")
+	if customize != nil {
+		customize(template)
+	}
+	return testcert.Issue(t, template, issuer)
+}
+
+func TestReasonName(t *testing.T) {
+	if ReasonName(1) != "keyCompromise" {
+		t.Errorf("unexpected name %q", ReasonName(1))
+	}
+	if code, ok := ReasonCode("superseded"); !ok || code != 4 {
+		t.Errorf("unexpected code %d", code)
+	}
+	if _, ok := ReasonCode("bogus"); ok {
+		t.Error("expected unknown reason to be rejected")
+	}
+}
+
+func TestIssuerPairs(t *testing.T) {
+	root := testcert.NewCA(t, "Root", nil)
+	intermediate := testcert.NewCA(t, "Intermediate", root)
+	leaf := newTestLeaf(t, intermediate, nil)
+
+	pairs := issuerPairs([]*x509.Certificate{leaf.Cert, intermediate.Cert, root.Cert})
+	if len(pairs) != 2 {
+		t.Fatalf("expected 2 pairs, got %d", len(pairs))
+	}
+	if pairs[0][0] != leaf.Cert || pairs[0][1] != intermediate.Cert {
+		t.Error("leaf should be paired with the intermediate")
+	}
+	if pairs[1][0] != intermediate.Cert || pairs[1][1] != root.Cert {
+		t.Error("intermediate should be paired with the root")
+	}
+
+	// without the root the intermediate is still listed
+	pairs = issuerPairs([]*x509.Certificate{leaf.Cert, intermediate.Cert})
+	if len(pairs) != 2 || pairs[1][0] != intermediate.Cert || pairs[1][1] != nil {
+		t.Error("intermediate should be listed without an issuer")
+	}
+}
@@ -0,0 +1,48 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package scan
+
+import (
+	"ssltool/pkg/details"
+	"time"
+)
+
+// Report is the machine-readable form of a scan. It shares its schema
+// version with details.Report.
+type Report struct {
+	SchemaVersion int           `json:"schema_version" yaml:"schema_version"`
+	Results       []ReportEntry `json:"results" yaml:"results"`
+}
+
+type ReportEntry struct {
+	Target       string                      `json:"target" yaml:"target"`
+	NotAfter     *time.Time                  `json:"not_after,omitempty" yaml:"not_after,omitempty"`
+	Attempts     int                         `json:"attempts" yaml:"attempts"`
+	Error        string                      `json:"error,omitempty" yaml:"error,omitempty"`
+	Certificates []details.CertificateReport `json:"certificates,omitempty" yaml:"certificates,omitempty"`
+}
+
+func NewReport(results []Result) Report {
+	report := Report{
+		SchemaVersion: details.SchemaVersion,
+		Results:       make([]ReportEntry, 0, len(results)),
+	}
+	for _, result := range results {
+		entry := ReportEntry{
+			Target:   result.Target.String(),
+			Attempts: result.Attempts,
+		}
+		if notAfter, ok := result.NotAfter(); ok {
+			notAfter = notAfter.UTC()
+			entry.NotAfter = &notAfter
+		}
+		if result.Err != nil {
+			entry.Error = result.Err.Error()
+		} else {
+			entry.Certificates = details.NewReport(entry.Target, result.Chain).Certificates
+		}
+		report.Results = append(report.Results, entry)
+	}
+	return report
+}
@@ -0,0 +1,205 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package scan
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sort"
+	"ssltool/pkg/details"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// schemePorts maps URL schemes to their default TLS port.
+var schemePorts = map[string]int{
+	"https": 443,
+	"ldaps": 636,
+	"smtps": 465,
+	"imaps": 993,
+	"pop3s": 995,
+	"ftps":  990,
+}
+
+type Target struct {
+	Host string
+	Port int
+}
+
+func (t Target) Address() string {
+	return net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+}
+
+func (t Target) String() string {
+	return t.Address()
+}
+
+// ParseTarget accepts host, host:port, [ipv6]:port and URL forms such as
+// https://www.example.com:8443/path.
+func ParseTarget(s string, defaultPort int) (Target, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Target{}, errors.New("empty target")
+	}
+	port := defaultPort
+	if strings.Contains(s, "://") {
+		u, err := url.Parse(s)
+		if err != nil {
+			return Target{}, fmt.Errorf("invalid target %q: %w", s, err)
+		}
+		if p, ok := schemePorts[strings.ToLower(u.Scheme)]; ok {
+			port = p
+		}
+		s = u.Host
+		if s == "" {
+			return Target{}, fmt.Errorf("invalid target %q: missing host", u.String())
+		}
+	}
+	host, portStr, err := net.SplitHostPort(s)
+	if err != nil {
+		// No port given; strip brackets from a bare IPv6 literal.
+		host = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+		return Target{Host: host, Port: port}, nil
+	}
+	p, err := strconv.Atoi(portStr)
+	if err != nil || p <= 0 || p > 65535 {
+		return Target{}, fmt.Errorf("invalid port in target %q", s)
+	}
+	if host == "" {
+		return Target{}, fmt.Errorf("invalid target %q: missing host", s)
+	}
+	return Target{Host: host, Port: p}, nil
+}
+
+// ReadTargets reads one target per line. Blank lines and lines starting
+// with # are ignored.
+func ReadTargets(r io.Reader, defaultPort int) ([]Target, error) {
+	var targets []Target
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		target, err := ParseTarget(line, defaultPort)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		targets = append(targets, target)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
+
+type Options struct {
+	Workers  int
+	Timeout  time.Duration
+	Retries  int
+	Insecure bool
+	Roots    *x509.CertPool
+}
+
+type Result struct {
+	Target   Target
+	Chain    []details.CertDetails
+	Err      error
+	Attempts int
+}
+
+// NotAfter returns the earliest expiry in the chain.
+func (r Result) NotAfter() (time.Time, bool) {
+	if r.Err != nil || len(r.Chain) == 0 {
+		return time.Time{}, false
+	}
+	soonest := r.Chain[0].NotAfter
+	for _, certDetails := range r.Chain[1:] {
+		if certDetails.NotAfter.Before(soonest) {
+			soonest = certDetails.NotAfter
+		}
+	}
+	return soonest, true
+}
+
+// Scan retrieves the chain of every target with a bounded worker pool.
+// Failures are recorded per target. Results are sorted by soonest expiry,
+// with failed targets last.
+func Scan(ctx context.Context, targets []Target, opts Options) []Result {
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]Result, len(targets))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = scanTarget(ctx, targets[i], opts)
+			}
+		}()
+	}
+	for i := range targets {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.SliceStable(results, func(i, j int) bool {
+		a, aOk := results[i].NotAfter()
+		b, bOk := results[j].NotAfter()
+		if aOk != bOk {
+			return aOk
+		}
+		return a.Before(b)
+	})
+	return results
+}
+
+func scanTarget(ctx context.Context, target Target, opts Options) Result {
+	result := Result{Target: target}
+	for attempt := 0; attempt <= opts.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				result.Err = ctx.Err()
+				return result
+			case <-time.After(time.Duration(attempt) * 500 * time.Millisecond):
+			}
+		}
+		result.Attempts++
+		attemptCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+		result.Chain, result.Err = details.RetrieveCertDetailsContext(attemptCtx, details.Options{
+			Address:  target.Address(),
+			Insecure: opts.Insecure,
+			Roots:    opts.Roots,
+		})
+		cancel()
+		if result.Err == nil || !retryable(result.Err) {
+			return result
+		}
+	}
+	return result
+}
+
+// retryable reports whether another attempt could succeed. Certificate
+// verification failures won't change between attempts.
+func retryable(err error) bool {
+	var verifyErr *tls.CertificateVerificationError
+	return !errors.As(err, &verifyErr)
+}
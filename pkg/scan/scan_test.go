@@ -0,0 +1,160 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package scan
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startTestTLSServer starts a localhost TLS server with a self-signed cert
+// expiring at notAfter and returns the target to reach it.
+func startTestTLSServer(t *testing.T, notAfter time.Time) Target {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: priv}},
+	})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	host, portStr, _ := net.SplitHostPort(ln.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	return Target{Host: host, Port: port}
+}
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Target
+	}{
+		{"www.example.com", Target{"www.example.com", 443}},
+		{"www.example.com:8443", Target{"www.example.com", 8443}},
+		{"https://www.example.com/path", Target{"www.example.com", 443}},
+		{"https://www.example.com:9443/", Target{"www.example.com", 9443}},
+		{"ldaps://ldap.example.com", Target{"ldap.example.com", 636}},
+		{"[2001:db8::1]:8443", Target{"2001:db8::1", 8443}},
+		{"2001:db8::1", Target{"2001:db8::1", 443}},
+		{"  10.0.0.5:636  ", Target{"10.0.0.5", 636}},
+	}
+	for _, tt := range tests {
+		got, err := ParseTarget(tt.in, 443)
+		if err != nil {
+			t.Errorf("ParseTarget(%q) returned error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseTarget(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "host:notaport", "host:70000", "https://"} {
+		if _, err := ParseTarget(bad, 443); err == nil {
+			t.Errorf("ParseTarget(%q) expected error", bad)
+		}
+	}
+}
+
+func TestReadTargets(t *testing.T) {
+	input := "# production\nwww.example.com\n\nhttps://api.example.com:8443\n"
+	targets, err := ReadTargets(strings.NewReader(input), 443)
+	if err != nil {
+		t.Fatalf("ReadTargets returned error: %v", err)
+	}
+	if len(targets) != 2 {
+		t.Fatalf("expected 2 targets, got %d", len(targets))
+	}
+	if targets[1].Port != 8443 {
+		t.Errorf("expected port 8443, got %d", targets[1].Port)
+	}
+	if _, err := ReadTargets(strings.NewReader("ok.example.com\nbad:port\n"), 443); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected error naming line 2, got %v", err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	later := startTestTLSServer(t, time.Now().Add(90*24*time.Hour))
+	sooner := startTestTLSServer(t, time.Now().Add(10*24*time.Hour))
+	// reserve a port and close it so nothing is listening there
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	deadPort := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	dead := Target{Host: "127.0.0.1", Port: deadPort}
+
+	results := Scan(context.Background(), []Target{dead, later, sooner}, Options{
+		Workers:  2,
+		Timeout:  2 * time.Second,
+		Retries:  1,
+		Insecure: true,
+	})
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+	if results[0].Target != sooner || results[1].Target != later {
+		t.Errorf("results not sorted by expiry: %v, %v", results[0].Target, results[1].Target)
+	}
+	if results[2].Target != dead || results[2].Err == nil {
+		t.Errorf("expected failed target last, got %v (err %v)", results[2].Target, results[2].Err)
+	}
+	if results[2].Attempts != 2 {
+		t.Errorf("expected 2 attempts for failed target, got %d", results[2].Attempts)
+	}
+
+	report := NewReport(results)
+	if report.Results[0].NotAfter == nil || len(report.Results[0].Certificates) != 1 {
+		t.Error("expected expiry and certificates for successful target")
+	}
+	if report.Results[2].Error == "" {
+		t.Error("expected error for failed target")
+	}
+}
+
+func TestScanDoesNotRetryVerificationFailure(t *testing.T) {
+	target := startTestTLSServer(t, time.Now().Add(24*time.Hour))
+	results := Scan(context.Background(), []Target{target}, Options{Workers: 1, Timeout: 2 * time.Second, Retries: 3})
+	if results[0].Err == nil {
+		t.Fatal("expected verification error for self-signed certificate")
+	}
+	if results[0].Attempts != 1 {
+		t.Errorf("expected a single attempt, got %d", results[0].Attempts)
+	}
+}
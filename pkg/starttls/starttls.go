@@ -0,0 +1,293 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package starttls
+
+import (
+	"bufio"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+)
+
+// Protocols lists the protocols accepted by Upgrade.
+var Protocols = []string{"smtp", "imap", "pop3", "ldap", "ftp", "xmpp", "postgres"}
+
+// Upgrade runs the protocol specific exchange on a plain connection that
+// asks the server to switch to TLS. When it returns without error the
+// caller can start the TLS handshake on conn.
+func Upgrade(conn net.Conn, protocol, host string) error {
+	var err error
+	switch strings.ToLower(protocol) {
+	case "smtp":
+		err = upgradeSMTP(conn)
+	case "imap":
+		err = upgradeIMAP(conn)
+	case "pop3":
+		err = upgradePOP3(conn)
+	case "ldap":
+		err = upgradeLDAP(conn)
+	case "ftp":
+		err = upgradeFTP(conn)
+	case "xmpp":
+		err = upgradeXMPP(conn, host)
+	case "postgres", "postgresql":
+		err = upgradePostgres(conn)
+	default:
+		return fmt.Errorf("unsupported starttls protocol: %s (use %s)", protocol, strings.Join(Protocols, ", "))
+	}
+	if err != nil {
+		return fmt.Errorf("%s starttls: %w", strings.ToLower(protocol), err)
+	}
+	return nil
+}
+
+func upgradeSMTP(conn net.Conn) error {
+	tp := textproto.NewConn(conn)
+	if _, _, err := tp.ReadResponse(220); err != nil {
+		return err
+	}
+	if err := tp.PrintfLine("EHLO ssltool"); err != nil {
+		return err
+	}
+	_, extensions, err := tp.ReadResponse(250)
+	if err != nil {
+		return err
+	}
+	if !hasLine(extensions, "STARTTLS") {
+		return errors.New("server does not advertise STARTTLS")
+	}
+	if err := tp.PrintfLine("STARTTLS"); err != nil {
+		return err
+	}
+	_, _, err = tp.ReadResponse(220)
+	return err
+}
+
+func upgradeIMAP(conn net.Conn) error {
+	tp := textproto.NewConn(conn)
+	greeting, err := tp.ReadLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(greeting, "* OK") {
+		return fmt.Errorf("unexpected greeting: %s", greeting)
+	}
+	if err := tp.PrintfLine("a1 STARTTLS"); err != nil {
+		return err
+	}
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(line, "a1 ") {
+			if !strings.HasPrefix(line, "a1 OK") {
+				return fmt.Errorf("server refused STARTTLS: %s", line)
+			}
+			return nil
+		}
+	}
+}
+
+func upgradePOP3(conn net.Conn) error {
+	tp := textproto.NewConn(conn)
+	greeting, err := tp.ReadLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(greeting, "+OK") {
+		return fmt.Errorf("unexpected greeting: %s", greeting)
+	}
+	if err := tp.PrintfLine("STLS"); err != nil {
+		return err
+	}
+	line, err := tp.ReadLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "+OK") {
+		return fmt.Errorf("server refused STLS: %s", line)
+	}
+	return nil
+}
+
+func upgradeFTP(conn net.Conn) error {
+	tp := textproto.NewConn(conn)
+	if _, _, err := tp.ReadResponse(220); err != nil {
+		return err
+	}
+	if err := tp.PrintfLine("AUTH TLS"); err != nil {
+		return err
+	}
+	_, _, err := tp.ReadResponse(234)
+	return err
+}
+
+// ldapStartTLSOID is the LDAP StartTLS extended operation (RFC 4511 4.14).
+const ldapStartTLSOID = "1.3.6.1.4.1.1466.20037"
+
+type ldapMessage struct {
+	MessageID int
+	Operation asn1.RawValue
+}
+
+func upgradeLDAP(conn net.Conn) error {
+	// ExtendedRequest ::= [APPLICATION 23] SEQUENCE { requestName [0] LDAPOID }
+	requestName, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: []byte(ldapStartTLSOID)})
+	if err != nil {
+		return err
+	}
+	request, err := asn1.Marshal(ldapMessage{
+		MessageID: 1,
+		Operation: asn1.RawValue{Class: asn1.ClassApplication, Tag: 23, IsCompound: true, Bytes: requestName},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	raw, err := readBERElement(conn)
+	if err != nil {
+		return err
+	}
+	var response ldapMessage
+	if _, err := asn1.Unmarshal(raw, &response); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	if response.Operation.Class != asn1.ClassApplication || response.Operation.Tag != 24 {
+		return fmt.Errorf("unexpected response operation %d", response.Operation.Tag)
+	}
+	// ExtendedResponse starts with the LDAPResult resultCode.
+	var resultCode asn1.Enumerated
+	if _, err := asn1.Unmarshal(response.Operation.Bytes, &resultCode); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	if resultCode != 0 {
+		return fmt.Errorf("server refused StartTLS with result code %d", resultCode)
+	}
+	return nil
+}
+
+// readBERElement reads exactly one BER encoded element so no bytes of the
+// following TLS handshake are consumed.
+func readBERElement(r io.Reader) ([]byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	length := int(header[1])
+	if header[1]&0x80 != 0 {
+		n := int(header[1] & 0x7f)
+		if n == 0 || n > 4 {
+			return nil, errors.New("unsupported BER length")
+		}
+		lengthBytes := make([]byte, n)
+		if _, err := io.ReadFull(r, lengthBytes); err != nil {
+			return nil, err
+		}
+		header = append(header, lengthBytes...)
+		length = 0
+		for _, b := range lengthBytes {
+			length = length<<8 | int(b)
+		}
+	}
+	if length > 1<<20 {
+		return nil, errors.New("response too large")
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return append(header, body...), nil
+}
+
+func upgradeXMPP(conn net.Conn, host string) error {
+	_, err := fmt.Fprintf(conn, "<?xml version='1.0'?><stream:stream to='%s' xmlns='jabber:client' "+
+		"xmlns:stream='http://etherx.jabber.org/streams' version='1.0'>", host)
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(conn)
+	features, err := readUntil(r, "</stream:features>")
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(features, "urn:ietf:params:xml:ns:xmpp-tls") {
+		return errors.New("server does not advertise starttls")
+	}
+	if _, err := io.WriteString(conn, "<starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>"); err != nil {
+		return err
+	}
+	reply, err := readUntil(r, "<proceed", "<failure")
+	if err != nil {
+		return err
+	}
+	if !strings.HasSuffix(reply, "<proceed") {
+		return errors.New("server refused starttls")
+	}
+	// Consume the rest of the proceed element.
+	_, err = readUntil(r, ">")
+	return err
+}
+
+// readUntil reads until one of the markers has been read and returns
+// everything read so far.
+func readUntil(r *bufio.Reader, markers ...string) (string, error) {
+	var sb strings.Builder
+	for sb.Len() < 64*1024 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return sb.String(), err
+		}
+		sb.WriteByte(b)
+		for _, marker := range markers {
+			if strings.HasSuffix(sb.String(), marker) {
+				return sb.String(), nil
+			}
+		}
+	}
+	return sb.String(), errors.New("response too large")
+}
+
+// postgresSSLRequestCode is the SSLRequest message code from the
+// PostgreSQL frontend/backend protocol.
+const postgresSSLRequestCode = 80877103
+
+func upgradePostgres(conn net.Conn) error {
+	request := make([]byte, 8)
+	binary.BigEndian.PutUint32(request[0:4], 8)
+	binary.BigEndian.PutUint32(request[4:8], postgresSSLRequestCode)
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+	reply := make([]byte, 1)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	switch reply[0] {
+	case 'S':
+		return nil
+	case 'N':
+		return errors.New("server does not support SSL")
+	default:
+		return fmt.Errorf("unexpected SSLRequest reply %q", reply[0])
+	}
+}
+
+func hasLine(lines, want string) bool {
+	for _, line := range strings.Split(lines, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && strings.EqualFold(fields[0], want) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+/*
+Copyright © 2023 Dex Wood
+*/
+package starttls
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeServer runs script against the server side of a pipe and returns the
+// client side.
+func fakeServer(t *testing.T, script func(r *bufio.Reader, w io.Writer)) net.Conn {
+	t.Helper()
+	client, server := net.Pipe()
+	go func() {
+		defer server.Close()
+		script(bufio.NewReader(server), server)
+	}()
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func expectLine(r *bufio.Reader, want string) bool {
+	line, err := r.ReadString('\n')
+	return err == nil && strings.TrimRight(line, "\r\n") == want
+}
+
+func TestUpgrade(t *testing.T) {
+	tests := []struct {
+		protocol string
+		script   func(r *bufio.Reader, w io.Writer)
+	}{
+		{"smtp", func(r *bufio.Reader, w io.Writer) {
+			io.WriteString(w, "220-mail.example.com ESMTP\r\n220 ready\r\n")
+			if !expectLine(r, "EHLO ssltool") {
+				return
+			}
+			io.WriteString(w, "250-mail.example.com\r\n250-PIPELINING\r\n250-STARTTLS\r\n250 8BITMIME\r\n")
+			if !expectLine(r, "STARTTLS") {
+				return
+			}
+			io.WriteString(w, "220 2.0.0 Ready to start TLS\r\n")
+		}},
+		{"imap", func(r *bufio.Reader, w io.Writer) {
+			io.WriteString(w, "* OK [CAPABILITY IMAP4rev1 STARTTLS] ready\r\n")
+			if !expectLine(r, "a1 STARTTLS") {
+				return
+			}
+			io.WriteString(w, "* CAPABILITY IMAP4rev1\r\na1 OK Begin TLS negotiation now\r\n")
+		}},
+		{"pop3", func(r *bufio.Reader, w io.Writer) {
+			io.WriteString(w, "+OK POP3 ready\r\n")
+			if !expectLine(r, "STLS") {
+				return
+			}
+			io.WriteString(w, "+OK Begin TLS\r\n")
+		}},
+		{"ftp", func(r *bufio.Reader, w io.Writer) {
+			io.WriteString(w, "220-Welcome\r\n220 FTP ready\r\n")
+			if !expectLine(r, "AUTH TLS") {
+				return
+			}
+			io.WriteString(w, "234 AUTH TLS OK\r\n")
+		}},
+		{"ldap", func(r *bufio.Reader, w io.Writer) {
+			request, err := readBERElement(r)
+			if err != nil || !strings.Contains(string(request), ldapStartTLSOID) {
+				return
+			}
+			// ExtendedResponse, messageID 1, resultCode success
+			w.Write([]byte{0x30, 0x0c, 0x02, 0x01, 0x01, 0x78, 0x07, 0x0a, 0x01, 0x00, 0x04, 0x00, 0x04, 0x00})
+		}},
+		{"xmpp", func(r *bufio.Reader, w io.Writer) {
+			if _, err := readUntil(r, "version='1.0'>"); err != nil {
+				return
+			}
+			io.WriteString(w, "<?xml version='1.0'?><stream:stream from='example.com' id='1' version='1.0' "+
+				"xmlns='jabber:client' xmlns:stream='http://etherx.jabber.org/streams'>"+
+				"<stream:features><starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'><required/></starttls></stream:features>")
+			if _, err := readUntil(r, "/>"); err != nil {
+				return
+			}
+			io.WriteString(w, "<proceed xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>")
+		}},
+		{"postgres", func(r *bufio.Reader, w io.Writer) {
+			request := make([]byte, 8)
+			if _, err := io.ReadFull(r, request); err != nil {
+				return
+			}
+			if string(request) != "\x00\x00\x00\x08\x04\xd2\x16\x2f" {
+				return
+			}
+			w.Write([]byte("S"))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.protocol, func(t *testing.T) {
+			conn := fakeServer(t, tt.script)
+			if err := Upgrade(conn, tt.protocol, "example.com"); err != nil {
+				t.Errorf("Upgrade failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestUpgradeRefused(t *testing.T) {
+	tests := []struct {
+		protocol string
+		script   func(r *bufio.Reader, w io.Writer)
+	}{
+		{"smtp", func(r *bufio.Reader, w io.Writer) {
+			io.WriteString(w, "220 ready\r\n")
+			r.ReadString('\n')
+			io.WriteString(w, "250-mail.example.com\r\n250 8BITMIME\r\n")
+		}},
+		{"ldap", func(r *bufio.Reader, w io.Writer) {
+			readBERElement(r)
+			// resultCode 2 (protocolError)
+			w.Write([]byte{0x30, 0x0c, 0x02, 0x01, 0x01, 0x78, 0x07, 0x0a, 0x01, 0x02, 0x04, 0x00, 0x04, 0x00})
+		}},
+		{"postgres", func(r *bufio.Reader, w io.Writer) {
+			io.ReadFull(r, make([]byte, 8))
+			w.Write([]byte("N"))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.protocol, func(t *testing.T) {
+			conn := fakeServer(t, tt.script)
+			if err := Upgrade(conn, tt.protocol, "example.com"); err == nil {
+				t.Error("expected Upgrade to fail")
+			}
+		})
+	}
+}
+
+func TestUpgradeUnsupportedProtocol(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	if err := Upgrade(client, "gopher", "example.com"); err == nil {
+		t.Error("expected error for unsupported protocol")
+	}
+}